@@ -0,0 +1,32 @@
+package hashstructure
+
+import (
+	"reflect"
+)
+
+// atomicPkgPath is the package path of the sync/atomic types, such as
+// atomic.Value and atomic.Int64.
+const atomicPkgPath = "sync/atomic"
+
+// visitAtomic hashes v, a sync/atomic type, by the value it holds, so that
+// an atomic.Int64 holding 5 hashes like int64(5). The types are matched by
+// package rather than named so that this works whichever of them the Go
+// version has. It returns false if v has no Load method.
+func (w *walker) visitAtomic(v reflect.Value, opts *visitOpts) (uint64, bool, error) {
+	// Load has a pointer receiver
+	if !v.CanAddr() {
+		tmp := reflect.New(v.Type()).Elem()
+		tmp.Set(v)
+		v = tmp
+	}
+
+	load := v.Addr().MethodByName("Load")
+	if !load.IsValid() {
+		return 0, false, nil
+	}
+
+	// An atomic.Value that was never stored to holds a nil interface,
+	// which is hashed like any other.
+	h, err := w.visit(load.Call(nil)[0], opts)
+	return h, true, err
+}
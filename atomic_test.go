@@ -0,0 +1,109 @@
+//go:build go1.19
+// +build go1.19
+
+package hashstructure
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestHash_atomicTypes(t *testing.T) {
+	type Stats struct {
+		Count   atomic.Int64
+		Hits    atomic.Uint32
+		Enabled atomic.Bool
+		Last    atomic.Value
+		Ptr     *atomic.Int64
+	}
+
+	newStats := func(count int64, hits uint32, enabled bool, last interface{}) *Stats {
+		s := &Stats{Ptr: new(atomic.Int64)}
+		s.Count.Store(count)
+		s.Hits.Store(hits)
+		s.Enabled.Store(enabled)
+		s.Ptr.Store(count)
+		if last != nil {
+			s.Last.Store(last)
+		}
+
+		return s
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{newStats(5, 1, true, "a"), newStats(5, 1, true, "a"), true},
+		{newStats(5, 1, true, "a"), newStats(6, 1, true, "a"), false},
+		{newStats(5, 1, true, "a"), newStats(5, 2, true, "a"), false},
+		{newStats(5, 1, true, "a"), newStats(5, 1, false, "a"), false},
+		{newStats(5, 1, true, "a"), newStats(5, 1, true, "b"), false},
+		{newStats(5, 1, true, nil), newStats(5, 1, true, nil), true},
+		{newStats(5, 1, true, nil), newStats(5, 1, true, "a"), false},
+
+		// Atomics hash like the values they hold, apart from the name of
+		// the struct
+		{newStats(5, 1, true, "a").Count.Load(), int64(5), true},
+		{&newStats(5, 1, true, "a").Count, int64(5), true},
+		{&newStats(5, 1, true, "a").Last, "a", true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// A struct of atomics hashes like the same struct of plain fields
+	for _, last := range []interface{}{nil, "a", 42} {
+		expected := func() uint64 {
+			type Stats struct {
+				Count   int64
+				Hits    uint32
+				Enabled bool
+				Last    interface{}
+				Ptr     *int64
+			}
+
+			count := int64(5)
+			h, err := Hash(&Stats{5, 1, true, last, &count}, testFormat, nil)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			return h
+		}()
+
+		actual, err := Hash(newStats(5, 1, true, last), testFormat, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != expected {
+			t.Fatalf("%#v: atomics don't hash like plain fields", last)
+		}
+	}
+
+	// FormatV1 is unchanged
+	one, err := Hash(newStats(5, 1, true, "a"), FormatV1, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(newStats(6, 2, false, "b"), FormatV1, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("FormatV1 hash changed")
+	}
+}
@@ -0,0 +1,59 @@
+package hashstructure
+
+import (
+	"hash"
+)
+
+// bufferedHasher batches writes to the underlying hasher, for hashers that
+// have a high cost per Write. The result is the same as writing directly.
+type bufferedHasher struct {
+	hash.Hash64
+	buf []byte
+}
+
+func newBufferedHasher(h hash.Hash64, size int) *bufferedHasher {
+	return &bufferedHasher{Hash64: h, buf: make([]byte, 0, size)}
+}
+
+func (h *bufferedHasher) Write(p []byte) (int, error) {
+	if len(h.buf)+len(p) > cap(h.buf) {
+		if err := h.flush(); err != nil {
+			return 0, err
+		}
+
+		// Writes that don't fit at all aren't copied
+		if len(p) > cap(h.buf) {
+			return h.Hash64.Write(p)
+		}
+	}
+
+	h.buf = append(h.buf, p...)
+	return len(p), nil
+}
+
+func (h *bufferedHasher) Sum(b []byte) []byte {
+	h.flush()
+	return h.Hash64.Sum(b)
+}
+
+func (h *bufferedHasher) Sum64() uint64 {
+	h.flush()
+	return h.Hash64.Sum64()
+}
+
+func (h *bufferedHasher) Reset() {
+	h.buf = h.buf[:0]
+	h.Hash64.Reset()
+}
+
+// flush writes the buffered bytes to the underlying hasher. Writing to a
+// hash never returns an error, but the error is passed on regardless.
+func (h *bufferedHasher) flush() error {
+	if len(h.buf) == 0 {
+		return nil
+	}
+
+	_, err := h.Hash64.Write(h.buf)
+	h.buf = h.buf[:0]
+	return err
+}
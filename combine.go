@@ -0,0 +1,51 @@
+package hashstructure
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// CombineOrdered combines hashes in a way that depends on their order,
+// the same way Hash combines the elements of a slice with the default
+// options. For example, CombineOrdered(a, b) usually differs from
+// CombineOrdered(b, a), and CombineOrdered(a, a) usually differs from
+// CombineOrdered(a). Combining no hashes results in zero.
+//
+// With FormatV2 and the default options, the hash of a slice is
+// CombineOrdered applied to the hashes of its elements.
+func CombineOrdered(hs ...uint64) uint64 {
+	h := fnv.New64()
+
+	var result uint64
+	for _, v := range hs {
+		result = hashUpdateOrdered(h, binary.LittleEndian, result, v)
+	}
+
+	return result
+}
+
+// CombineUnordered combines hashes in a way that doesn't depend on their
+// order, the same way Hash combines the elements of a slice tagged as a
+// set with the default options. CombineUnordered(a, b) always equals
+// CombineUnordered(b, a). Duplicates are ignored, so CombineUnordered(a, a)
+// equals CombineUnordered(a), but the result otherwise differs from the
+// hash of any subset. Combining no hashes results in a fixed, non-zero
+// value.
+//
+// With FormatV2 and the default options, the hash of a slice tagged as a
+// set is CombineUnordered applied to the hashes of its elements.
+func CombineUnordered(hs ...uint64) uint64 {
+	seen := make(map[uint64]struct{}, len(hs))
+
+	var result uint64
+	for _, v := range hs {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+
+		result = hashUpdateUnordered(result, v)
+	}
+
+	return hashFinishUnordered(fnv.New64(), binary.LittleEndian, result)
+}
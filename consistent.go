@@ -0,0 +1,186 @@
+package hashstructure
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+)
+
+// consistentRounds is the number of times each value is hashed by
+// AssertConsistent. Map ordering is random in Go so we hash many times
+// to try to tease out variability.
+const consistentRounds = 100
+
+// AssertConsistent verifies that the documented invariants of Hash hold
+// for each of the given values with the given format and options. It is
+// meant as a testing aid, for example when plugging in a custom Hasher.
+//
+// The following are checked:
+//
+//   - Hashing the same value repeatedly always results in the same hash.
+//     Since map iteration order is random, this also checks that maps are
+//     hashed independently of their ordering.
+//
+//   - Shuffling the elements of slices that are treated as sets (via the
+//     "set" tag or SlicesAsSets) doesn't change the hash.
+//
+// The first violation found is returned as an error.
+func AssertConsistent(format Format, opts *HashOptions, vs ...interface{}) error {
+	// Shuffles use a fixed seed so that failures are reproducible
+	r := rand.New(rand.NewSource(1))
+
+	for _, v := range vs {
+		expected, err := Hash(v, format, opts)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < consistentRounds; i++ {
+			actual, err := Hash(v, format, opts)
+			if err != nil {
+				return err
+			}
+
+			if actual != expected {
+				return fmt.Errorf(
+					"hashstructure: non-deterministic hash for %#v: %d != %d",
+					v, actual, expected)
+			}
+		}
+
+		sets := opts != nil && opts.SlicesAsSets
+		tag := "hash"
+		if opts != nil && opts.TagName != "" {
+			tag = opts.TagName
+		}
+
+		for i := 0; i < consistentRounds; i++ {
+			shuffled := shuffleSets(reflect.ValueOf(v), tag, sets, sets, r, make(map[cycleKey]reflect.Value))
+			if !shuffled.IsValid() {
+				break
+			}
+
+			actual, err := Hash(shuffled.Interface(), format, opts)
+			if err != nil {
+				return err
+			}
+
+			if actual != expected {
+				return fmt.Errorf(
+					"hashstructure: set ordering changed hash for %#v: %d != %d",
+					v, actual, expected)
+			}
+		}
+	}
+
+	return nil
+}
+
+// shuffleSets returns a deep copy of v where every slice that is hashed as
+// a set has its elements randomly reordered. If set is true, v itself is
+// hashed as a set. If all is true, every slice is hashed as a set.
+//
+// Pointers, maps and slices are only copied once, with the copy recorded in
+// copies, so that sharing and self-references are preserved in the result.
+func shuffleSets(v reflect.Value, tag string, set, all bool, r *rand.Rand, copies map[cycleKey]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		result := reflect.New(v.Type()).Elem()
+		result.Set(shuffleSets(v.Elem(), tag, set, all, r, copies))
+		return result
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		k := newCycleKey(v)
+		if c, ok := copies[k]; ok {
+			return c
+		}
+
+		result := reflect.New(v.Type().Elem())
+		copies[k] = result
+		result.Elem().Set(shuffleSets(v.Elem(), tag, set, all, r, copies))
+		return result
+
+	case reflect.Array:
+		result := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(shuffleSets(v.Index(i), tag, false, all, r, copies))
+		}
+
+		return result
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		k := newCycleKey(v)
+		if c, ok := copies[k]; ok {
+			return c
+		}
+
+		result := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		copies[k] = result
+		for i := 0; i < v.Len(); i++ {
+			result.Index(i).Set(shuffleSets(v.Index(i), tag, false, all, r, copies))
+		}
+
+		if set || all {
+			r.Shuffle(result.Len(), reflect.Swapper(result.Interface()))
+		}
+
+		return result
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		k := newCycleKey(v)
+		if c, ok := copies[k]; ok {
+			return c
+		}
+
+		result := reflect.MakeMapWithSize(v.Type(), v.Len())
+		copies[k] = result
+		for _, k := range v.MapKeys() {
+			result.SetMapIndex(k, shuffleSets(v.MapIndex(k), tag, false, all, r, copies))
+		}
+
+		return result
+
+	case reflect.Struct:
+		// Types that hash themselves may not honor our tags, so leave
+		// them alone.
+		if _, ok := v.Interface().(Hashable); ok {
+			return v
+		}
+		if reflect.PtrTo(v.Type()).Implements(reflect.TypeOf((*Hashable)(nil)).Elem()) {
+			return v
+		}
+
+		result := reflect.New(v.Type()).Elem()
+		result.Set(v)
+
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// Unexported, these are never hashed
+				continue
+			}
+
+			fieldSet := f.Tag.Get(tag) == "set"
+			result.Field(i).Set(shuffleSets(v.Field(i), tag, fieldSet, all, r, copies))
+		}
+
+		return result
+
+	default:
+		return v
+	}
+}
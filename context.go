@@ -0,0 +1,39 @@
+package hashstructure
+
+import (
+	"context"
+	"reflect"
+)
+
+// HashContext returns the hash value of v like Hash, but also applies the
+// transformers that opts.ContextTransformers returns for ctx. This allows
+// the same value to be hashed differently per request, for example to
+// redact personal data according to the policy of each tenant.
+//
+// Transformers from the context take precedence over those in
+// opts.Transformers, which take precedence over those installed with
+// RegisterType. The context is only used to look up transformers; hashing
+// isn't interrupted if it is cancelled.
+func HashContext(ctx context.Context, v interface{}, format Format, opts *HashOptions) (uint64, error) {
+	if opts == nil || opts.ContextTransformers == nil {
+		return Hash(v, format, opts)
+	}
+
+	fromCtx := opts.ContextTransformers(ctx)
+	if len(fromCtx) == 0 {
+		return Hash(v, format, opts)
+	}
+
+	transformers := make(map[reflect.Type]func(interface{}) interface{}, len(opts.Transformers)+len(fromCtx))
+	for t, fn := range opts.Transformers {
+		transformers[t] = fn
+	}
+	for t, fn := range fromCtx {
+		transformers[t] = fn
+	}
+
+	// Copy the options so that they can still be shared
+	ctxOpts := *opts
+	ctxOpts.Transformers = transformers
+	return Hash(v, format, &ctxOpts)
+}
@@ -0,0 +1,127 @@
+package hashstructure
+
+import (
+	"reflect"
+	"sync"
+)
+
+// cycleKey identifies a pointer, map or slice. The type is required since
+// a struct and its first field share an address, and the length is
+// required since a slice may contain a shorter slice of the same array.
+type cycleKey struct {
+	Type reflect.Type
+	Ptr  uintptr
+	Len  int
+}
+
+func newCycleKey(v reflect.Value) cycleKey {
+	k := cycleKey{Type: v.Type(), Ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		k.Len = v.Len()
+	}
+
+	return k
+}
+
+// cycleSet is the set of pointers, maps and slices that are currently
+// being visited, used to detect values that refer to themselves. Each is
+// mapped to the number of values that were already being visited when it
+// was entered, which is its depth.
+type cycleSet map[cycleKey]int
+
+// enter marks v as being visited. It returns false if v is already being
+// visited, which means that the value refers to itself. Each successful
+// enter must be paired with a leave once v has been visited.
+func (s cycleSet) enter(v reflect.Value) bool {
+	k := newCycleKey(v)
+	if _, ok := s[k]; ok {
+		return false
+	}
+
+	s[k] = len(s)
+	return true
+}
+
+// distance returns how many levels up v is from the innermost value being
+// visited. v must be in the set.
+func (s cycleSet) distance(v reflect.Value) int {
+	return len(s) - s[newCycleKey(v)]
+}
+
+// leave marks v as no longer being visited.
+func (s cycleSet) leave(v reflect.Value) {
+	delete(s, newCycleKey(v))
+}
+
+// cycleTypesCache caches the result of typeMayCycle by type.
+var cycleTypesCache sync.Map
+
+// typeMayCycle returns whether a value of type t may refer back to itself,
+// which is only possible if t can contain itself or an interface. Every
+// value on a cycle is of such a type, so the others don't need to be
+// tracked, and the distances of cycles stay the same without them.
+func typeMayCycle(t reflect.Type) bool {
+	if c, ok := cycleTypesCache.Load(t); ok {
+		return c.(bool)
+	}
+
+	c := typeReaches(t, t, make(map[reflect.Type]struct{}))
+	cycleTypesCache.Store(t, c)
+	return c
+}
+
+// typeReaches returns whether t contains the type target or an interface,
+// looking through its elements, keys and fields.
+func typeReaches(t, target reflect.Type, seen map[reflect.Type]struct{}) bool {
+	var elems []reflect.Type
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		elems = []reflect.Type{t.Elem()}
+	case reflect.Map:
+		elems = []reflect.Type{t.Key(), t.Elem()}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			elems = append(elems, t.Field(i).Type)
+		}
+	}
+
+	for _, e := range elems {
+		if e == target || e.Kind() == reflect.Interface {
+			return true
+		}
+		if _, ok := seen[e]; ok {
+			continue
+		}
+
+		seen[e] = struct{}{}
+		if typeReaches(e, target, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mayCycle returns whether values of type t must be tracked to detect
+// cycles. Values returned by transformers, getters and other hooks aren't
+// part of the type, so they may refer back to anything.
+func (w *walker) mayCycle(t reflect.Type) bool {
+	return w.hookValues || typeMayCycle(t)
+}
+
+// cycleMarker is hashed in place of a value that refers back to one of
+// the values that contains it.
+var cycleMarker = []byte("hashstructure: cycle")
+
+// visitCycle returns the hash used for v, which refers back to one of the
+// values that contains it. This includes how many levels up the value is
+// rather than its address, so that equal cyclic values hash the same while
+// cycles of different shapes don't.
+func (w *walker) visitCycle(v reflect.Value) (uint64, error) {
+	w.h.Reset()
+	if _, err := w.h.Write(cycleMarker); err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, w.h.Sum64(), uint64(w.visiting.distance(v))), nil
+}
@@ -0,0 +1,111 @@
+package hashstructure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CollisionPair describes two of the values given to CheckDistinct that
+// have the same hash.
+type CollisionPair struct {
+	// I and J are the indexes of the colliding values, with I < J.
+	I, J int
+
+	// Hash is the hash of both values.
+	Hash uint64
+
+	// Ignored lists everything that was skipped while hashing either
+	// value, as "path (reason)" using the paths and reasons of OnIgnore.
+	// Values usually collide because they only differ in something that
+	// is listed here.
+	Ignored []string
+}
+
+// String describes the collision, including why it may have happened.
+func (c CollisionPair) String() string {
+	s := fmt.Sprintf("values %d and %d both hash to %d", c.I, c.J, c.Hash)
+	if len(c.Ignored) == 0 {
+		return s + "; nothing was ignored, so they hash the same bytes"
+	}
+
+	return s + "; ignored: " + strings.Join(c.Ignored, ", ")
+}
+
+// CheckDistinct hashes each of the given values, which are expected to be
+// distinct, using FormatV2 and the given options. It returns a pair for
+// each two values that have the same hash. It is meant as a testing aid to
+// catch values that are accidentally hashed the same, such as when they
+// only differ in unexported fields.
+//
+// OnIgnore, if set in opts, is still called.
+func CheckDistinct(vs []interface{}, opts *HashOptions) ([]CollisionPair, error) {
+	var o HashOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	// Record what is ignored for each value. OnIgnore may be called
+	// concurrently with the Parallel option.
+	var lock sync.Mutex
+	var ignored []string
+	onIgnore := o.OnIgnore
+	o.OnIgnore = func(path, reason string) {
+		lock.Lock()
+		ignored = append(ignored, fmt.Sprintf("%s (%s)", path, reason))
+		lock.Unlock()
+
+		if onIgnore != nil {
+			onIgnore(path, reason)
+		}
+	}
+
+	hashes := make([]uint64, len(vs))
+	ignoredBy := make([][]string, len(vs))
+	for i, v := range vs {
+		ignored = nil
+		h, err := Hash(v, FormatV2, &o)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[i] = h
+		ignoredBy[i] = ignored
+	}
+
+	var pairs []CollisionPair
+	for i := range vs {
+		for j := i + 1; j < len(vs); j++ {
+			if hashes[i] != hashes[j] {
+				continue
+			}
+
+			pairs = append(pairs, CollisionPair{
+				I:       i,
+				J:       j,
+				Hash:    hashes[i],
+				Ignored: mergeIgnored(ignoredBy[i], ignoredBy[j]),
+			})
+		}
+	}
+
+	return pairs, nil
+}
+
+// mergeIgnored returns the sorted union of a and b.
+func mergeIgnored(a, b []string) []string {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	var result []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+
+		seen[s] = struct{}{}
+		result = append(result, s)
+	}
+
+	sort.Strings(result)
+	return result
+}
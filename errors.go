@@ -2,6 +2,7 @@ package hashstructure
 
 import (
 	"fmt"
+	"reflect"
 )
 
 // ErrNotStringer is returned when there's an error with hash:"string"
@@ -20,3 +21,105 @@ type ErrFormat struct{}
 func (*ErrFormat) Error() string {
 	return "format must be one of the defined Format values in the hashstructure library"
 }
+
+// ErrNotStruct is returned when there's an error with hash:"inline"
+type ErrNotStruct struct {
+	Field string
+}
+
+// Error implements error for ErrNotStruct
+func (ens *ErrNotStruct) Error() string {
+	return fmt.Sprintf("hashstructure: %s has hash:\"inline\" set, but is not a struct", ens.Field)
+}
+
+// ErrInvalidTag is returned when a struct field has a hash tag that can't
+// be parsed, such as hash:"precision=x"
+type ErrInvalidTag struct {
+	Field string
+	Tag   string
+}
+
+// Error implements error for ErrInvalidTag
+func (eit *ErrInvalidTag) Error() string {
+	return fmt.Sprintf("hashstructure: %s has invalid hash:%q", eit.Field, eit.Tag)
+}
+
+// ErrTooLarge is returned when more than HashOptions.MaxBytes bytes would
+// be written to the Hasher.
+type ErrTooLarge struct {
+	MaxBytes int
+}
+
+// Error implements error for ErrTooLarge
+func (etl *ErrTooLarge) Error() string {
+	return fmt.Sprintf("hashstructure: value exceeds the limit of %d bytes", etl.MaxBytes)
+}
+
+// ErrNotBytes is returned when there's an error with hash:"bytes"
+type ErrNotBytes struct {
+	Field string
+}
+
+// Error implements error for ErrNotBytes
+func (enb *ErrNotBytes) Error() string {
+	return fmt.Sprintf("hashstructure: %s has hash:\"bytes\" set, but is not a byte slice or array", enb.Field)
+}
+
+// ErrUnsupportedKind is returned when a value of a kind that can't be
+// hashed, such as a chan, is encountered.
+type ErrUnsupportedKind struct {
+	Kind reflect.Kind
+
+	// Path is the location of the value, such as "Foo.Bar[2]". It is empty
+	// for the value given to Hash.
+	Path string
+}
+
+// Error implements error for ErrUnsupportedKind
+func (euk *ErrUnsupportedKind) Error() string {
+	if euk.Path == "" {
+		return fmt.Sprintf("unknown kind to hash: %s", euk.Kind)
+	}
+
+	return fmt.Sprintf("unknown kind to hash: %s at %s", euk.Kind, euk.Path)
+}
+
+// ErrNondeterministic is returned when HashOptions.Deterministic is set and
+// a value whose hash could vary between runs is encountered.
+type ErrNondeterministic struct {
+	// Reason is what can't be hashed deterministically, such as "NaN".
+	Reason string
+
+	// Path is the location of the value, such as "Foo.Bar[2]". It is empty
+	// for the value given to Hash and for the Hasher itself.
+	Path string
+}
+
+// Error implements error for ErrNondeterministic
+func (en *ErrNondeterministic) Error() string {
+	if en.Path == "" {
+		return fmt.Sprintf("hashstructure: %s can't be hashed deterministically", en.Reason)
+	}
+
+	return fmt.Sprintf("hashstructure: %s can't be hashed deterministically at %s", en.Reason, en.Path)
+}
+
+// ErrGetterCycle is returned when HashOptions.UseGetters is set and a
+// getter returns its own struct type by value, which would otherwise be
+// hashed forever.
+type ErrGetterCycle struct {
+	Type reflect.Type
+
+	// Path is the location of the value, such as "Foo.Bar[2]". It is empty
+	// for the value given to Hash.
+	Path string
+}
+
+// Error implements error for ErrGetterCycle
+func (egc *ErrGetterCycle) Error() string {
+	if egc.Path == "" {
+		return fmt.Sprintf("hashstructure: getters of %s return it by value", egc.Type)
+	}
+
+	return fmt.Sprintf("hashstructure: getters of %s return it by value at %s", egc.Type, egc.Path)
+}
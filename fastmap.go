@@ -0,0 +1,132 @@
+package hashstructure
+
+import (
+	"reflect"
+)
+
+var stringType = reflect.TypeOf("")
+var intType = reflect.TypeOf(0)
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+var mapStringStringType = reflect.TypeOf(map[string]string(nil))
+var mapStringIntType = reflect.TypeOf(map[string]int(nil))
+var mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
+
+// visitMapFast hashes the entries of maps of strings to strings, ints or
+// interfaces without reflecting over every key, since these are by far the
+// most common maps. The result is exactly that of visitMapEntries. It
+// returns false if m is another kind of map or the options require each
+// entry to be visited in full.
+func (w *walker) visitMapFast(m reflect.Value, mv *mapVisit) (uint64, bool, error) {
+	if !m.CanInterface() || !w.plainScalars() ||
+		mv.transform != nil || mv.include != nil || mv.ignoreKeys != nil ||
+		mv.sortEntries || w.prune != nil {
+		return 0, false, nil
+	}
+
+	t := m.Type()
+	if t.Key() != stringType {
+		return 0, false, nil
+	}
+
+	var h uint64
+	switch t.Elem() {
+	case stringType:
+		for k, v := range m.Convert(mapStringStringType).Interface().(map[string]string) {
+			kh, err := w.hashString(k)
+			if err != nil {
+				return 0, false, err
+			}
+			vh, err := w.hashString(v)
+			if err != nil {
+				return 0, false, err
+			}
+
+			h = hashUpdateUnordered(h, hashUpdateOrdered(w.h, w.order, kh, vh))
+		}
+
+	case intType:
+		for k, v := range m.Convert(mapStringIntType).Interface().(map[string]int) {
+			kh, err := w.hashString(k)
+			if err != nil {
+				return 0, false, err
+			}
+			vh, err := w.hashInt(int64(v))
+			if err != nil {
+				return 0, false, err
+			}
+
+			h = hashUpdateUnordered(h, hashUpdateOrdered(w.h, w.order, kh, vh))
+		}
+
+	case interfaceType:
+		// The values are visited as usual, which skips and ignores
+		// entries if requested.
+		if w.skipNaN || w.nilAsMissing {
+			return 0, false, nil
+		}
+
+		for k, v := range m.Convert(mapStringInterfaceType).Interface().(map[string]interface{}) {
+			kh, err := w.hashString(k)
+			if err != nil {
+				return 0, false, err
+			}
+
+			// Keep the interface, as MapIndex would, so that the value
+			// is visited exactly as on the slow path.
+			w.pushKey(reflect.ValueOf(k))
+			vh, err := w.visit(reflect.ValueOf(&v).Elem(), mv.valueOpts)
+			if err != nil {
+				return 0, false, err
+			}
+			w.popPath()
+
+			h = hashUpdateUnordered(h, hashUpdateOrdered(w.h, w.order, kh, vh))
+		}
+
+	default:
+		return 0, false, nil
+	}
+
+	return h, true, nil
+}
+
+// plainScalars returns true if plain strings and ints are hashed by their
+// bytes alone, so that hashString and hashInt match visit.
+func (w *walker) plainScalars() bool {
+	if w.logger != nil || w.marshaler != nil || w.stringifyAll || w.numericStrings {
+		return false
+	}
+
+	for _, t := range []reflect.Type{stringType, intType} {
+		if w.transformers[t] != nil || w.registered[t] != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hashString returns the hash of s, as visit would.
+func (w *walker) hashString(s string) (uint64, error) {
+	w.h.Reset()
+	if err := w.writeCategory(reflect.String); err != nil {
+		return 0, err
+	}
+
+	_, err := w.h.Write([]byte(s))
+	return w.h.Sum64(), err
+}
+
+// hashInt returns the hash of i, as visit would.
+func (w *walker) hashInt(i int64) (uint64, error) {
+	w.h.Reset()
+	if err := w.writeCategory(reflect.Int64); err != nil {
+		return 0, err
+	}
+
+	var b [8]byte
+	w.order.PutUint64(b[:], uint64(i))
+	_, err := w.h.Write(b[:])
+	return w.h.Sum64(), err
+}
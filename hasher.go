@@ -0,0 +1,116 @@
+package hashstructure
+
+import (
+	"encoding"
+	"hash"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+// Hasher hashes values with a fixed format and options, reusing the same
+// hash function for every value. A Hasher is not safe for concurrent use;
+// use a HasherPool to share Hashers between goroutines.
+type Hasher struct {
+	format Format
+	opts   HashOptions
+}
+
+// NewHasher returns a Hasher that hashes values with the given format and
+// options, as described by Hash. The options are copied, but the Hasher
+// within them is not, so it must not be used elsewhere while the returned
+// Hasher is in use.
+func NewHasher(format Format, opts *HashOptions) *Hasher {
+	h := &Hasher{format: format}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Hasher == nil {
+		h.opts.Hasher = fnv.New64()
+	}
+	h.opts.ownHasher = true
+
+	return h
+}
+
+// Hash returns the hash value of v. The underlying hash function is reset
+// before hashing, so no state is carried between calls.
+func (h *Hasher) Hash(v interface{}) (uint64, error) {
+	return Hash(v, h.format, &h.opts)
+}
+
+// HasherPool is a pool of Hashers that all use the same format and
+// options. The zero value is not usable; Format must be set. A HasherPool
+// must not be copied after first use.
+type HasherPool struct {
+	// Format is the format used by every Hasher in the pool.
+	Format Format
+
+	// Options are the options used by every Hasher in the pool. The
+	// Hasher field is ignored since each Hasher needs its own hash
+	// function; use NewHash instead.
+	Options HashOptions
+
+	// NewHash returns the hash function for a new Hasher. If this isn't
+	// set, it will default to FNV.
+	NewHash func() hash.Hash64
+
+	pool sync.Pool
+}
+
+// Get returns a Hasher from the pool, creating one if needed. The Hasher
+// should be returned with Put once it is no longer in use.
+func (p *HasherPool) Get() *Hasher {
+	if h, ok := p.pool.Get().(*Hasher); ok {
+		return h
+	}
+
+	opts := p.Options
+	opts.Hasher = nil
+	if p.NewHash != nil {
+		opts.Hasher = p.NewHash()
+	}
+
+	return NewHasher(p.Format, &opts)
+}
+
+// Put returns a Hasher to the pool. The Hasher must not be used after
+// this. Hashers must only be returned to the pool they came from.
+func (p *HasherPool) Put(h *Hasher) {
+	p.pool.Put(h)
+}
+
+// cloneHasher returns a new hash function with the same state as h, so
+// that h itself isn't written to. This works for pointers that can marshal
+// and unmarshal their state, such as the hashes from hash/fnv. It returns
+// false for any other hash function.
+func cloneHasher(h hash.Hash64) (hash.Hash64, bool) {
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, false
+	}
+
+	t := reflect.TypeOf(h)
+	if t.Kind() != reflect.Ptr {
+		return nil, false
+	}
+
+	c, ok := reflect.New(t.Elem()).Interface().(hash.Hash64)
+	if !ok {
+		return nil, false
+	}
+	u, ok := c.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, false
+	}
+
+	state, err := m.MarshalBinary()
+	if err != nil {
+		return nil, false
+	}
+	if err := u.UnmarshalBinary(state); err != nil {
+		return nil, false
+	}
+
+	return c, true
+}
@@ -1,20 +1,44 @@
 package hashstructure
 
 import (
+	"context"
+	"database/sql/driver"
 	"encoding/binary"
+	"encoding/gob"
 	"fmt"
 	"hash"
 	"hash/fnv"
+	"math"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // HashOptions are options that are available for hashing.
 type HashOptions struct {
 	// Hasher is the hash function to use. If this isn't set, it will
-	// default to FNV.
+	// default to a new FNV hash for every call to Hash.
+	//
+	// Hash never writes to the Hasher if it can make a copy of it, which
+	// is the case for pointers that implement encoding.BinaryMarshaler
+	// and encoding.BinaryUnmarshaler, such as the hashes from hash/fnv.
+	// Any other Hasher is written to directly, so the options MUST NOT be
+	// used by more than one goroutine at a time. Use HasherFactory to
+	// share such options between goroutines.
 	Hasher hash.Hash64
 
+	// HasherFactory, if set, returns the hash function to use and is
+	// called once for every call to Hash. This takes precedence over
+	// Hasher, and unlike Hasher allows the options to be shared between
+	// goroutines that hash concurrently, as long as the options aren't
+	// modified while in use.
+	HasherFactory func() hash.Hash64
+
 	// TagName is the struct tag to look at when hashing the structure.
 	// By default this is "hash".
 	TagName string
@@ -25,6 +49,14 @@ type HashOptions struct {
 
 	// IgnoreZeroValue is determining if zero value fields should be
 	// ignored for hash calculation.
+	//
+	// This applies to every exported field of every struct within the
+	// value, as decided by reflect.Value.IsZero, so it works as a global
+	// omitempty: fields can be added to a struct without changing the
+	// hash of values that leave them unset. In turn, structs that differ
+	// only by fields that are zero in one and absent in the other hash the
+	// same on purpose. Empty but non-nil slices and maps aren't zero, see
+	// IgnoreEmptyCollections. Default is false.
 	IgnoreZeroValue bool
 
 	// SlicesAsSets assumes that a `set` tag is always present for slices.
@@ -37,14 +69,536 @@ type HashOptions struct {
 	// precedence (meaning that if the type doesn't implement fmt.Stringer, we
 	// panic)
 	UseStringer bool
+
+	// CanonicalNumbers hashes numeric values by magnitude rather than by
+	// type. All integers are widened to int64 (or uint64 if they don't fit)
+	// and all floats are widened to float64, so int8(5), int(5) and
+	// uint64(5) produce the same hash. Default is false.
+	CanonicalNumbers bool
+
+	// SharePointers makes structural sharing part of the hash. When the
+	// same pointer is reachable from more than one place in the value,
+	// every reference to it is hashed together with the number of
+	// references. Two values that are equal field-by-field but share
+	// pointers differently will then hash differently.
+	//
+	// Every reference is marked, rather than only the second one seen,
+	// because map iteration order is random and the hash must remain
+	// deterministic. Values with no shared pointers hash the same as
+	// when this is false. A pointer to a struct and a pointer to its first
+	// field aren't shared, and pointers to zero-size values are never
+	// shared. Only references that are hashed count, so pointers in
+	// ignored, redacted or pruned fields don't. The value is walked twice
+	// to count them, so functions such as Transformers are called twice
+	// for each value. Default is false.
+	SharePointers bool
+
+	// IgnoreSyncPrimitives skips struct fields whose type is one of the
+	// sync package primitives (Mutex, RWMutex, Once, WaitGroup, Cond) or a
+	// pointer to one. Their internal state is unexported and so never
+	// affects the hash, but the field itself does, so this allows adding
+	// or removing a lock without changing the hash. Default is false.
+	IgnoreSyncPrimitives bool
+
+	// OrderedMaps hashes maps as an ordered sequence of entries sorted by
+	// the hash of their keys, rather than XOR-ing the entry hashes
+	// together. The result is still independent of iteration order, but
+	// every entry is fed through the hash function so entries can't cancel
+	// each other out the way they can with XOR. This is slower since the
+	// entries must be sorted. Default is false.
+	OrderedMaps bool
+
+	// NamedTypeIdentity makes the name of defined types part of the hash
+	// for booleans, numbers and strings. For example, os.FileMode(0644)
+	// will hash differently than int(420) and any other defined integer
+	// type with the same value. The names of structs, which are always
+	// part of the hash, are qualified by their package path so that
+	// structs with the same name in different packages differ.
+	// Default is false.
+	NamedTypeIdentity bool
+
+	// OnIgnore, if set, is called for each struct field or map entry that
+	// is skipped while hashing. The path is the location of the skipped
+	// value, such as "Foo.Bar[2]". The reason is one of:
+	//
+	//   - "unexported" - the struct field is unexported
+	//   - "tag" - the struct field is tagged with "ignore" or "-", or the
+	//     map entry is skipped by an "ignorekeys" tag
+	//   - "sync" - the struct field is skipped by IgnoreSyncPrimitives
+	//   - "zero" - the struct field is skipped by IgnoreZeroValue
+	//   - "empty" - the struct field is skipped by IgnoreEmptyCollections
+	//   - "prune" - the value is skipped by Prune
+	//   - "opaque" - the struct is skipped by IgnoreUnexportedStructs
+	//   - "nan" - the value is skipped by SkipNaN
+	//   - "nil" - the map entry is skipped by TreatNilMapValuesAsMissing
+	//   - "func" - the func value or struct field is skipped by IgnoreFuncs
+	//   - "interface" - the struct field is skipped by IgnoreInterfaces
+	//   - "redact" - the value of the struct field is replaced by a marker
+	//     because it is tagged with "redact"
+	//   - "include" - Includable or IncludableMap excluded the value
+	//   - "name" - the struct field was skipped by FieldName
+	//   - "stringer" - the struct has only unexported fields, so nothing but
+	//     its name was hashed, yet it implements fmt.Stringer. Hashing it
+	//     with the "string" tag or UseStringer is likely what's wanted.
+	OnIgnore func(path string, reason string)
+
+	// IncludeTags makes the full struct tag of each hashed field part of
+	// the hash, so changing a tag (such as a JSON name) changes the hash
+	// even if the values don't. Fields without tags are unaffected.
+	// Default is false.
+	IncludeTags bool
+
+	// FuncsByPointer hashes func values by their code pointer rather than
+	// returning an error. This only makes two funcs hash the same if they
+	// are the same function; it says nothing about closure state. Code
+	// pointers vary between builds and processes, so hashes generated with
+	// this option must not be persisted or shared. Default is false.
+	FuncsByPointer bool
+
+	// ByteOrder is the byte order used to write numbers, including lengths
+	// and intermediate hashes, to the Hasher. If this isn't set, it will
+	// default to binary.LittleEndian regardless of the architecture, so
+	// hashes are the same on every platform.
+	ByteOrder binary.ByteOrder
+
+	// Logger, if set, is called after each value is hashed with the path
+	// to the value, its kind, and the number of bytes written to the
+	// Hasher while hashing it (including any children). Values are logged
+	// in the order they are finished, so comparing the logs for two values
+	// shows exactly where they differ. This includes intermediate values
+	// such as field names, which are logged with the path of their struct.
+	Logger func(path string, kind reflect.Kind, bytesWritten int)
+
+	// CanonicalJSON hashes the canonical JSON encoding of the value instead
+	// of walking it. The value is encoded with encoding/json, then all
+	// object keys are sorted, insignificant whitespace is removed and
+	// numbers are written exactly as encoding/json formats them. The same
+	// bytes can be reproduced in other languages, so hashes can be compared
+	// across systems as long as they use the same Hasher.
+	//
+	// This is slower, and since encoding/json rules apply, the "hash" tags
+	// and all other options other than Hasher are ignored. Default is false.
+	CanonicalJSON bool
+
+	// StringifyAll hashes every value other than a struct as the text
+	// produced by fmt.Sprintf("%#v", v). Structs are still walked so that
+	// tags and field names apply, but each field value is rendered as text.
+	// This is slower and coarser but easy to audit. Note that pointers
+	// nested within a rendered value are printed as addresses, which vary
+	// between runs. Default is false.
+	StringifyAll bool
+
+	// TypedNilInterfaces hashes a nil interface value, such as a nil
+	// error or io.Reader field, as its static interface type along with a
+	// nil marker. By default, nil interfaces are hashed like a zero int,
+	// so nil values of different interface types hash the same.
+	// Default is false.
+	TypedNilInterfaces bool
+
+	// SortFields visits struct fields sorted by name rather than in
+	// declaration order. Struct fields are not hashed independently of
+	// their order, so this gives a canonical order that doesn't depend on
+	// how a struct is declared. Default is false.
+	SortFields bool
+
+	// Marshaler, if set, is called with each value before it is walked.
+	// If it returns true, the returned bytes are hashed in place of the
+	// value, as with RawBytes. This allows hashing values by a canonical
+	// encoding, for example protobuf messages with a deterministic
+	// proto.MarshalOptions, without this library depending on the encoder.
+	// It is also how to hash third-party types that keep their state in
+	// unexported fields, such as decimals. Values are passed as they
+	// appear, so pointers are not dereferenced. Byte arrays, net.IP,
+	// net.IPMask and net.HardwareAddr are passed whole, but not their
+	// bytes, which are hashed all at once.
+	Marshaler func(v interface{}) ([]byte, bool, error)
+
+	// FloatPrecision, if greater than zero, rounds floats to this many
+	// decimal places before hashing, so that nearly equal values such as
+	// 0.1+0.2 and 0.3 hash equal. Negative zero is hashed as zero and all
+	// NaN values are hashed the same. Default is zero, meaning floats are
+	// hashed exactly.
+	FloatPrecision int
+
+	// UseCanonical hashes values that implement Canonicalizer by the
+	// value returned from Canonical rather than the value itself.
+	// Default is false.
+	UseCanonical bool
+
+	// RawMessageBytes hashes json.RawMessage values by their raw bytes
+	// rather than element by element, which is much faster. The hash is
+	// still sensitive to whitespace and key order within the JSON.
+	// Default is false.
+	RawMessageBytes bool
+
+	// CanonicalRawMessages hashes json.RawMessage values by their
+	// canonical JSON encoding, as described by CanonicalJSON, so that
+	// whitespace and key order within the JSON don't affect the hash.
+	// It is an error if a json.RawMessage isn't valid JSON. This takes
+	// precedence over RawMessageBytes. Default is false.
+	CanonicalRawMessages bool
+
+	// FieldName, if set, is called for each exported struct field to get
+	// the name that is hashed for the field, in place of the Go field name.
+	// If it returns true for skip, the field is ignored. This allows
+	// deriving field identity from the tags of any encoding, such as yaml
+	// or bson. The "hash" tags are still honored.
+	FieldName func(f reflect.StructField) (name string, skip bool)
+
+	// DistinctBools hashes booleans with a marker so that they differ from
+	// numbers. By default true and false are hashed as int8(1) and int8(0).
+	// Default is false.
+	DistinctBools bool
+
+	// MaxBytes, if greater than zero, limits the number of bytes written to
+	// the Hasher. Once more than this many bytes have been written, the
+	// remaining writes are dropped and Hash returns an *ErrTooLarge. This
+	// bounds the work done for untrusted values. Default is zero, meaning
+	// there is no limit.
+	MaxBytes int
+
+	// Fallback, if set, is called with values of kinds that can't be
+	// hashed otherwise, such as chans and funcs. If it returns true for
+	// handled, the returned hash is used for the value. Otherwise, Hash
+	// returns an error as it would without a Fallback.
+	Fallback func(v reflect.Value) (hash uint64, handled bool, err error)
+
+	// IgnoreEmptyCollections skips struct fields that are slices or maps
+	// with no elements, whether they are nil or empty. Adding such a field
+	// to a struct then doesn't change the hash as long as it stays empty.
+	// Default is false.
+	IgnoreEmptyCollections bool
+
+	// Prune, if set, is called with the path of each struct field, map
+	// value and slice or array element before it is visited, such as
+	// "Spec.Containers[0]". If it returns true, the value and everything
+	// within it is skipped as if it were ignored. Since the walker never
+	// descends into pruned values, this is cheap even for large subtrees.
+	Prune func(path string) bool
+
+	// UseGetters hashes structs that have fields but no exported ones by
+	// the results of their getter methods instead. A getter is an exported
+	// method named "Get" followed by a name, such as GetName, that takes no
+	// arguments and returns exactly one value. Each result is hashed like a
+	// field with the name following "Get", so GetName is hashed as a field
+	// named Name. Pointer receiver methods are only used if the struct is
+	// addressable, such as when Hash is given a pointer to it. Getters that
+	// return their own struct type by value would recurse forever, so they
+	// cause an ErrGetterCycle. Default is false.
+	UseGetters bool
+
+	// Transformers maps types to functions that return the value to hash
+	// in place of values of exactly that type. These take precedence over
+	// transformers installed with RegisterType.
+	Transformers map[reflect.Type]func(interface{}) interface{}
+
+	// ContextTransformers, if set, returns transformers for the context
+	// given to HashContext, on top of Transformers. It is ignored by Hash.
+	// See HashContext for precedence. Default is nil.
+	ContextTransformers func(ctx context.Context) map[reflect.Type]func(interface{}) interface{}
+
+	// IgnoreUnexportedStructs hashes structs that have fields but no
+	// exported ones, such as opaque types from other packages, as their
+	// name and a marker rather than walking them. Each one is reported to
+	// OnIgnore, so dependencies that contribute nothing to the hash are
+	// made explicit. UseGetters takes precedence. Default is false.
+	IgnoreUnexportedStructs bool
+
+	// Parallel hashes the entries of large maps concurrently, with one
+	// goroutine per CPU. The result is exactly the same as without this
+	// option. This requires HasherFactory to be set, or the Hasher to be
+	// the default FNV, and has no effect with Logger or MaxBytes. Any
+	// callbacks, such as OnIgnore, and methods such as Hashable.Hash may
+	// then be called concurrently. Default is false.
+	Parallel bool
+
+	// UseGoStringer hashes every value that implements fmt.GoStringer by
+	// the result of its GoString method rather than by its structure.
+	// Unlike UseStringer, this applies to all values and not only struct
+	// fields, though UseStringer and the "string" tag take precedence for
+	// the fields they apply to. The "gostring" tag differs in that it uses
+	// fmt's Go syntax representation, which only calls GoString if it is
+	// implemented. Default is false.
+	UseGoStringer bool
+
+	// SkipNaN skips floats and complex numbers that are NaN, as if they
+	// were absent, wherever they are a struct field, slice or array
+	// element, or map key or value. This is useful when NaN means a value
+	// is missing. Values that contain NaNs will hash differently than
+	// without this option. Default is false.
+	SkipNaN bool
+
+	// ResetPolicy controls what happens to the state of the Hasher when
+	// Hash is called. See ResetAlways and ResetNever. Default is
+	// ResetAlways.
+	ResetPolicy ResetPolicy
+
+	// ScalarCategories hashes every number and string together with its
+	// category: signed integer, unsigned integer, float, complex or string.
+	// Booleans are hashed as with DistinctBools, and nil interfaces and
+	// pointers as nil rather than as zero. Scalars of different categories
+	// then never hash the same, even if their bytes do, which matters for
+	// heterogeneous values such as decoded JSON documents. This
+	// composes with CanonicalNumbers, which is applied first.
+	// Default is false.
+	ScalarCategories bool
+
+	// NameTag is the struct tag that gives the name hashed for each field,
+	// in place of the Go field name, such as "json". The name is the part
+	// of the tag before the first comma. Fields without a name in the tag,
+	// or named "-", use the Go field name. This only affects names: whether
+	// and how a field is hashed is still controlled by the TagName tag, so
+	// a field tagged `json:"-"` is still hashed. FieldName takes precedence
+	// if it is set.
+	NameTag string
+
+	// UseGobEncoder hashes every value that implements gob.GobEncoder by
+	// the bytes returned from its GobEncode method, as with RawBytes,
+	// rather than by its structure. This suits types that keep their state
+	// in unexported fields but expose a canonical encoding, such as
+	// big.Int. Default is false.
+	UseGobEncoder bool
+
+	// TreatNilMapValuesAsMissing skips map entries whose value is nil,
+	// including nil pointers, slices and maps and interfaces holding them,
+	// so that a map with a nil entry hashes the same as the map without
+	// it. For example, the decoded JSON {"k": null} and {} hash the same.
+	// Entries are skipped before ZeroNil would apply to their values.
+	// Default is false.
+	TreatNilMapValuesAsMissing bool
+
+	// TimesAsInstants hashes time.Time values by the instant they
+	// represent, ignoring their location, so the same instant in UTC and
+	// in local time hash the same. This applies to every time.Time,
+	// wherever it is within the value. The monotonic clock reading is
+	// never part of the hash. Default is false.
+	TimesAsInstants bool
+
+	// UseValuer hashes every value that implements driver.Valuer, such as
+	// sql.NullTime, by the result of its Value method rather than by its
+	// structure. The result is hashed like any other value, so options
+	// such as TimesAsInstants apply to it, and isn't replaced by its own
+	// Value again. A nil result, which is NULL, hashes differently than
+	// any zero value. This aligns the hash of an entity with what is stored
+	// in the database. Default is false.
+	UseValuer bool
+
+	// Merkle hashes slices as the root of a binary Merkle tree over the
+	// hashes of their elements rather than folding them in order. Sets,
+	// multisets and rotation invariant slices are unaffected. The result
+	// is still deterministic, and with MerkleHash it can be updated in
+	// O(log n) when one element of a large slice changes.
+	// Default is false.
+	Merkle bool
+
+	// NilPointersDistinct hashes every nil pointer as nil, at any depth,
+	// so that a missing optional value never hashes the same as a present
+	// zero value. For example, a nil *int differs from a pointer to 0.
+	// This takes precedence over ZeroNil. Default is false.
+	NilPointersDistinct bool
+
+	// PreHash, if set, is called once with the value given to Hash, and
+	// the value it returns is hashed instead. This suits transformations
+	// of the whole value, such as redacting a deep copy of it. It runs
+	// before anything else, so Transformers, types registered with
+	// RegisterType and every other option apply to its result.
+	PreHash func(v interface{}) (interface{}, error)
+
+	// ArrayLengths writes the length of each array along with a marker
+	// before its elements, so arrays never hash the same as slices or as
+	// arrays of a different length, such as [2]int{1, 2} and []int{1, 2}.
+	// Byte arrays already include their length. Default is false.
+	ArrayLengths bool
+
+	// Deterministic makes Hash return an ErrNondeterministic rather than
+	// hash a value whose hash could differ between runs, machines or
+	// builds with the other options given. This is a safety rail for
+	// hashes that are persisted. The following are refused:
+	//
+	//   - func values hashed by FuncsByPointer, since code pointers vary
+	//     between builds
+	//   - NaN floats and complex numbers with a NaN part that aren't
+	//     skipped by SkipNaN, since the bits of a NaN vary by platform.
+	//     Floats rounded by FloatPrecision or a precision tag, or hashed
+	//     as text by NumericAsString, are allowed.
+	//   - time.Time values in time.Local without TimesAsInstants, since
+	//     their offset depends on the machine's time zone
+	//   - a Hasher from NewMaphashHasher, since its seed is random
+	//   - values formatted by StringifyAll or the "gostring" tag that
+	//     contain pointers, funcs or chans, since their addresses are
+	//     printed
+	//   - values hashed by their GoString method with UseGoStringer,
+	//     which may print addresses too
+	//
+	// Maps are hashed independently of their order and so are allowed.
+	// Nothing can be known about user code such as Hashable, Fallback or
+	// Marshaler, which must be deterministic themselves. Default is false.
+	Deterministic bool
+
+	// IncludeNilMarker hashes every nil the same way, as a marker that
+	// differs from the zero value of any type: the nil given to Hash, nil
+	// pointers, slices, maps, funcs and interfaces, and interfaces holding
+	// any of these. So a nil slice differs from an empty one, and a nil
+	// *int from a pointer to 0. This takes precedence over ZeroNil, but
+	// not over TypedNilInterfaces. Default is false.
+	IncludeNilMarker bool
+
+	// SliceDedup assumes that a "dedup" tag is present for slices that
+	// aren't otherwise tagged, so duplicate elements are removed before
+	// hashing but order still matters. SlicesAsSets takes precedence.
+	// Default is false.
+	SliceDedup bool
+
+	// IncludeUnexported hashes unexported struct fields like exported
+	// ones, rather than ignoring them. They are read with package unsafe.
+	// Fields of kinds that can't be hashed, such as funcs, then cause an
+	// error even if unexported. Default is false.
+	IncludeUnexported bool
+
+	// DeepEqualSemantics is a preset that overrides other options so that
+	// two values hash the same nearly exactly when reflect.DeepEqual
+	// reports them as equal. It sets IncludeUnexported, IncludeNilMarker,
+	// NamedTypeIdentity, ScalarCategories, ArrayLengths and
+	// IgnoreSyncPrimitives, and clears every option that makes different
+	// values hash the same: ZeroNil, IgnoreZeroValue, SlicesAsSets,
+	// SliceDedup, UseStringer, CanonicalNumbers, FloatPrecision,
+	// IgnoreEmptyCollections, TimesAsInstants, TreatNilMapValuesAsMissing,
+	// CanonicalJSON, StringifyAll, UseCanonical, UseGoStringer,
+	// UseGobEncoder, UseValuer, UseHashMarshaler, UseGetters,
+	// IgnoreUnexportedStructs, SkipNaN, CanonicalRawMessages, IgnoreFuncs,
+	// IgnoreInterfaces, NumericAsString, NumbersMatchStrings and
+	// URLsAsStrings. Functions given by the caller, such as Marshaler and
+	// Transformers, are still used. The options given to Hash aren't
+	// modified.
+	//
+	// Some differences remain:
+	//
+	//   - ints and uints hash the same as their 64-bit equivalents
+	//   - pointers hash the same as what they point to
+	//   - nil and empty values of different types, such as a nil *int and
+	//     an empty []string, can hash the same
+	//   - NaN hashes equal to itself
+	//   - times are compared without their monotonic clock reading
+	//   - the state of sync primitives is ignored
+	//   - tags such as "set" and "ignore" are still honored
+	//
+	// Default is false.
+	DeepEqualSemantics bool
+
+	// IgnoreFuncs skips struct fields of func type, and hashes every other
+	// func value, such as the elements of a []func() or the values of a
+	// map[string]func(), as the same fixed marker rather than returning an
+	// error. So a slice of funcs hashes by its length and a map of funcs
+	// by its keys. FuncsByPointer takes precedence. Default is false.
+	IgnoreFuncs bool
+
+	// BufferSize, if greater than zero, batches the bytes written to the
+	// Hasher through a buffer of this many bytes, flushing it before each
+	// sum. The hash is the same either way. Since each value is summed on
+	// its own, little is batched, and this only helps Hashers that have a
+	// high cost for each Write. Default is zero, meaning no buffer.
+	BufferSize int
+
+	// UseHashMarshaler hashes every value that implements HashMarshaler by
+	// the bytes returned from its MarshalHash method rather than by its
+	// structure. The Marshaler and Transformers options still take
+	// precedence over it. Default is false.
+	UseHashMarshaler bool
+
+	// IncludeSliceCap includes the capacity of each slice in its hash, so
+	// that slices with the same elements but a different capacity hash
+	// differently. This is for fingerprints that depend on memory layout.
+	// Default is false.
+	IncludeSliceCap bool
+
+	// HMACKey, if set, makes the hash keyed so that it can't be forged
+	// without the key, for example to detect tampering of persisted
+	// config. Every value is hashed with HMAC using this key and HMACHash,
+	// in place of Hasher and HasherFactory, and the result is the first
+	// 8 bytes of the HMAC. An empty, non-nil key is allowed but gives no
+	// protection. Default is nil.
+	HMACKey []byte
+
+	// HMACHash is the cryptographic hash function used with HMACKey. Its
+	// sums must be at least 8 bytes, or Hash returns an error. It is
+	// ignored if HMACKey is nil. Default is sha256.New.
+	HMACHash func() hash.Hash
+
+	// TypeNames, if set, hashes each non-nil interface value within the
+	// value being hashed together with the name of its dynamic type, so
+	// that values of different types behind an interface differ even if
+	// they have the same fields. The name is looked up here, as for types
+	// registered for gob or JSON polymorphism, which keeps the hash stable
+	// if a type moves between packages. Types that aren't in the map are
+	// named by their package path and name. Pointers are named by the type
+	// they point to. Default is nil.
+	TypeNames map[reflect.Type]string
+
+	// IgnoreInterfaces skips struct fields whose declared type is one of
+	// these interface types, such as an io.Reader or io.Writer used for
+	// plumbing, whatever value they hold. Fields of other types are hashed
+	// as usual even if they implement one of the interfaces. Default is
+	// nil.
+	IgnoreInterfaces []reflect.Type
+
+	// NumericAsString hashes integers and floats by their shortest decimal
+	// text, as formatted by strconv, rather than by their binary form, to
+	// match systems that hash numbers as base 10 strings. So 1 and 1.0
+	// hash the same, and float32(1.1) hashes like float64(1.1) since both
+	// are "1.1". Numbers are still marked as numbers, so they differ from
+	// strings with the same text unless NumbersMatchStrings is set.
+	// Floats are rounded by FloatPrecision first. Booleans hash as with
+	// DistinctBools, and complex numbers are unaffected. Default is false.
+	NumericAsString bool
+
+	// NumbersMatchStrings hashes the numbers formatted by NumericAsString
+	// exactly like strings with the same text, so 1, 1.0 and "1" all hash
+	// the same. This is only for matching systems that don't tell numbers
+	// and strings apart, since it makes values of different types
+	// collide. It has no effect without NumericAsString, and
+	// ScalarCategories takes precedence. Default is false.
+	NumbersMatchStrings bool
+
+	// URLsAsStrings hashes url.URL values and pointers to them by their
+	// String form rather than by their fields, so that equivalent URLs
+	// hash the same however their fields are set. A nil *url.URL is hashed
+	// as a marker that differs from every URL. Default is false.
+	URLsAsStrings bool
+
+	// ownHasher is set when the options, along with their Hasher, belong
+	// to a single Hasher, so the Hasher is used directly.
+	ownHasher bool
 }
 
+// ResetPolicy controls what happens to the state of the Hasher when Hash
+// is called.
+type ResetPolicy uint
+
+const (
+	// ResetAlways discards any state in the Hasher before hashing, so the
+	// result only depends on the value.
+	ResetAlways ResetPolicy = iota
+
+	// ResetNever folds the state the Hasher was given, as returned by its
+	// Sum64, into the result. This allows seeding the hash with data that
+	// was written to the Hasher beforehand. Hashers created by Hash, from
+	// HasherFactory, HMACKey or the default, have no state, so the result
+	// is the same as with ResetAlways. The Hasher is still used and
+	// reset internally while hashing, so its state afterwards is
+	// unspecified; use the returned hash rather than the Hasher's Sum64.
+	ResetNever
+)
+
 // Format specifies the hashing process used. Different formats typically
 // generate different hashes for the same value and have different properties.
 type Format uint
 
+// The hash generated for a value with a given format (and options) doesn't
+// change between releases of this library. Changes to the hashing process
+// that alter the output are made by adding a new format, unless they fix
+// distinct values hashing the same. FormatV1 never changes.
 const (
-	// To disallow the zero value
+	// To disallow the zero value. Passing this to Hash uses DefaultFormat.
 	formatInvalid Format = iota
 
 	// FormatV1 is the format used in v1.x of this library. This has the
@@ -58,44 +612,151 @@ const (
 	formatMax // so we can easily find the end
 )
 
+// DefaultFormat is the format used when Hash is called with the zero
+// Format. This may be changed to a newer format in future releases, so
+// callers that persist hashes should either always pass a format to Hash
+// or pin this value at init, for example:
+//
+//	func init() {
+//	    hashstructure.DefaultFormat = hashstructure.FormatV2
+//	}
+var DefaultFormat = FormatV2
+
+// RawBytes is a byte slice that is written directly to the hash function
+// rather than being walked element by element. It can be used to fold
+// pre-serialized data, such as an encoded message or a precomputed digest,
+// into a hash efficiently. The length of the slice is written before the
+// bytes.
+type RawBytes []byte
+
 // Hash returns the hash value of an arbitrary value.
 //
 // If opts is nil, then default options will be used. See HashOptions
-// for the default values. The same *HashOptions value cannot be used
-// concurrently. None of the values within a *HashOptions struct are
-// safe to read/write while hashing is being done.
+// for the default values. The same *HashOptions value can be used
+// concurrently, as long as it isn't modified while hashing is being done
+// and its Hasher is safe to share, as described by HashOptions.Hasher.
 //
-// The "format" is required and must be one of the format values defined
-// by this library. You should probably just use "FormatV2". This allows
-// generated hashes uses alternate logic to maintain compatibility with
-// older versions.
+// The "format" must be one of the format values defined by this library,
+// or zero to use DefaultFormat. You should probably just use "FormatV2".
+// This allows generated hashes uses alternate logic to maintain
+// compatibility with older versions.
 //
 // Notes on the value:
 //
-//   * Unexported fields on structs are ignored and do not affect the
+//   - Unexported fields on structs are ignored and do not affect the
 //     hash value.
 //
-//   * Adding an exported field to a struct with the zero value will change
-//     the hash value.
+//   - Adding an exported field to a struct with the zero value will change
+//     the hash value, as will removing one, since the name of each field is
+//     hashed along with its value. With IgnoreZeroValue, fields that are
+//     zero don't contribute to the hash, so adding or removing them
+//     doesn't change it.
+//
+//   - Each struct field is hashed on its own and combined with its name,
+//     so the values of adjacent fields can't run together. For example,
+//     {A: "ab", B: "c"} and {A: "a", B: "bc"} hash differently, and no
+//     separator between fields is needed.
+//
+//   - The name of a struct type is part of its hash, so values of different
+//     struct types differ even if they have no fields, such as marker types
+//     behind a common interface.
+//
+//   - Maps are hashed independently of their iteration order. Since map
+//     keys are unique, entries can't cancel each other out, so sets such as
+//     map[string]struct{} hash equal exactly when they have the same
+//     members.
+//
+//   - Pointer map keys are hashed by the values they point to, like any
+//     other pointer, rather than by address. Keys that point to equal
+//     values are still distinct entries, so map[*T]int{&a: 1, &b: 1}
+//     differs from an empty map even if a and b are equal.
+//
+//   - Byte arrays, such as [16]byte UUIDs, are hashed by their contents
+//     as a whole, so they hash differently than byte slices. Options that
+//     apply to numbers don't apply to their elements.
+//
+//   - IP addresses, masks and hardware addresses are hashed by their
+//     bytes as a whole, with IPv4 addresses in their 4 byte form. With
+//     NamedTypeIdentity, the name of their type is hashed too.
+//
+//   - Times are hashed by their instant and location, but not by their
+//     monotonic clock reading. See TimesAsInstants to ignore the location.
+//
+//   - Regexps are hashed by their pattern, URLs by their string form and
+//     time.Locations by their name.
+//
+//   - The sync/atomic types, such as atomic.Value and atomic.Int64, are
+//     hashed by the value they hold, so an atomic.Int64 holding 5 hashes
+//     like int64(5). An empty atomic.Value is a nil interface.
+//
+//   - Pointers, maps and slices that refer back to a value that contains
+//     them are hashed as a fixed marker rather than being followed.
 //
 // For structs, the hashing can be controlled using tags. For example:
 //
-//    struct {
-//        Name string
-//        UUID string `hash:"ignore"`
-//    }
+//	struct {
+//	    Name string
+//	    UUID string `hash:"ignore"`
+//	}
 //
 // The available tag values are:
 //
-//   * "ignore" or "-" - The field will be ignored and not affect the hash code.
+//   - "ignore" or "-" - The field will be ignored and not affect the hash code.
+//
+//   - "redact" - The value of the field will be replaced by a fixed marker,
+//     so the field is still part of the hash but its value isn't. Unlike
+//     "ignore", removing the field changes the hash. Options that skip
+//     fields by their value, such as IgnoreZeroValue, don't apply to it.
+//
+//   - "set" - The field will be treated as a set, where ordering doesn't
+//     affect the hash code and duplicate elements are ignored (except with
+//     FormatV1, where pairs of duplicates cancel each other out). This only
+//     works for slices, and maps whose values are slices, in which case
+//     each value is treated as a set.
+//
+//   - "multiset" - Like "set", but the number of times each element
+//     appears affects the hash code, so {a, a, b} and {a, b} differ.
+//
+//   - "dedup" - The field will be hashed in order with duplicate elements
+//     removed, keeping the first occurrence of each. So {a, b, a} and
+//     {a, b} are equal but {b, a} differs. Unlike "set", order matters,
+//     and unlike "multiset", duplicates don't. This only works for slices,
+//     and takes precedence over SlicesAsSets.
+//
+//   - "rotinvariant" - The field will be treated as a cyclic sequence,
+//     where rotating the elements doesn't affect the hash code, so
+//     {a, b, c} and {c, a, b} are equal but {a, c, b} differs. The element
+//     hashes are rotated to the lexicographically least rotation before
+//     being hashed in order. This only works for slices.
+//
+//   - "string" - The field will be hashed as a string, only works when the
+//     field implements fmt.Stringer. Pointer receivers are used when the
+//     struct is addressable, such as when Hash is given a pointer to it.
 //
-//   * "set" - The field will be treated as a set, where ordering doesn't
-//             affect the hash code. This only works for slices.
+//   - "bytes" - The field will be hashed as a single blob of bytes, like
+//     RawBytes. This only works for slices and arrays of bytes, including
+//     defined types such as a [32]byte digest.
 //
-//   * "string" - The field will be hashed as a string, only works when the
-//                field implements fmt.Stringer
+//   - "gostring" - The field will be hashed as the string produced by
+//     fmt.Sprintf("%#v", v), after dereferencing any pointers.
 //
-func Hash(v interface{}, format Format, opts *HashOptions) (uint64, error) {
+//   - "precision=N" - Floats within the field will be rounded to N decimal
+//     places before hashing, as with FloatPrecision, for this field only.
+//     N must be greater than zero.
+//
+//   - "ignorekeys=k1,k2" - The entries of the map with the listed keys will
+//     be skipped, as if they weren't in the map. This only works for maps
+//     with string keys, and pointers to them.
+//
+//   - "inline" - The fields of the field will be hashed as if they were
+//     fields of the parent struct. This only works for structs and
+//     pointers to structs.
+func Hash(v interface{}, format Format, opts *HashOptions) (result uint64, err error) {
+	// Use the default format if none was given
+	if format == formatInvalid {
+		format = DefaultFormat
+	}
+
 	// Validate our format
 	if format <= formatInvalid || format >= formatMax {
 		return 0, &ErrFormat{}
@@ -105,37 +766,271 @@ func Hash(v interface{}, format Format, opts *HashOptions) (uint64, error) {
 	if opts == nil {
 		opts = &HashOptions{}
 	}
-	if opts.Hasher == nil {
-		opts.Hasher = fnv.New64()
+	if opts.DeepEqualSemantics {
+		opts = deepEqualOptions(opts)
+	}
+	h := opts.Hasher
+	newHash := opts.HasherFactory
+	given := false
+	if opts.HMACKey != nil {
+		if newHash, err = newHMACFactory(opts.HMACHash, opts.HMACKey); err != nil {
+			return 0, err
+		}
+		h = newHash()
+	} else if newHash != nil {
+		h = newHash()
+	} else if h == nil {
+		h = fnv.New64()
+	} else {
+		given = true
+
+		// Leave the given Hasher untouched so that it can be shared
+		if !opts.ownHasher {
+			if c, ok := cloneHasher(h); ok {
+				h = c
+			}
+		}
+	}
+	if newHash == nil && reflect.TypeOf(h) == fnvType {
+		newHash = fnv.New64
+	}
+	if opts.Deterministic && reflect.TypeOf(h) == maphashType {
+		return 0, &ErrNondeterministic{Reason: "maphash hasher"}
+	}
+	order := opts.ByteOrder
+	if order == nil {
+		order = binary.LittleEndian
+	}
+
+	// Transform the whole value first if requested
+	if opts.PreHash != nil {
+		if v, err = opts.PreHash(v); err != nil {
+			return 0, err
+		}
+	}
+
+	// Fold in the state the hash was given once we're done, if requested.
+	// This uses the hash itself rather than the wrappers below, so that
+	// the fold isn't buffered or counted. A hash we just created has no
+	// state to fold.
+	base := h
+	seeded := opts.ResetPolicy == ResetNever && given
+	var seed uint64
+	if seeded {
+		seed = h.Sum64()
 	}
-	if opts.TagName == "" {
-		opts.TagName = "hash"
+	fold := func(result uint64) uint64 {
+		if !seeded {
+			return result
+		}
+
+		return hashUpdateOrdered(base, order, seed, result)
 	}
 
 	// Reset the hash
-	opts.Hasher.Reset()
+	h.Reset()
+
+	if opts.CanonicalJSON {
+		if result, err = hashJSON(h, v); err != nil {
+			return 0, err
+		}
+
+		return fold(result), nil
+	}
+
+	// Batch writes if requested
+	if opts.BufferSize > 0 {
+		h = newBufferedHasher(h, opts.BufferSize)
+	}
+
+	// If we're logging or limiting the size, count the bytes that are
+	// written
+	var counter *countingHasher
+	if opts.Logger != nil || opts.MaxBytes > 0 {
+		counter = &countingHasher{Hash64: h, max: opts.MaxBytes}
+		h = counter
+	}
 
 	// Create our walker and walk the structure
+	w := newWalker(format, h, order, opts)
+	w.newHash = newHash
+	w.counter = counter
+	if opts.SharePointers {
+		if w.pointers, err = w.countPointers(reflect.ValueOf(v)); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err = w.visit(reflect.ValueOf(v), nil)
+	if err != nil {
+		return 0, err
+	}
+	result = fold(result)
+	if counter != nil && counter.tooLarge() {
+		return 0, &ErrTooLarge{MaxBytes: counter.max}
+	}
+
+	return result, nil
+}
+
+// newWalker returns a walker writing to h with the given options. The
+// caller sets up anything that depends on the value being hashed.
+func newWalker(format Format, h hash.Hash64, order binary.ByteOrder, opts *HashOptions) *walker {
+	tag := opts.TagName
+	if tag == "" {
+		tag = "hash"
+	}
+
 	w := &walker{
-		format:          format,
-		h:               opts.Hasher,
-		tag:             opts.TagName,
-		zeronil:         opts.ZeroNil,
-		ignorezerovalue: opts.IgnoreZeroValue,
-		sets:            opts.SlicesAsSets,
-		stringer:        opts.UseStringer,
+		format:           format,
+		h:                h,
+		order:            order,
+		tag:              tag,
+		zeronil:          opts.ZeroNil,
+		ignorezerovalue:  opts.IgnoreZeroValue,
+		sets:             opts.SlicesAsSets,
+		stringer:         opts.UseStringer,
+		canonicalNumbers: opts.CanonicalNumbers,
+		ignoreSync:       opts.IgnoreSyncPrimitives,
+		orderedMaps:      opts.OrderedMaps,
+		namedTypes:       opts.NamedTypeIdentity,
+		onIgnore:         opts.OnIgnore,
+		includeTags:      opts.IncludeTags,
+		funcsByPointer:   opts.FuncsByPointer,
+		logger:           opts.Logger,
+		stringifyAll:     opts.StringifyAll,
+		typedNils:        opts.TypedNilInterfaces,
+		sortFields:       opts.SortFields,
+		marshaler:        opts.Marshaler,
+		floatPrecision:   opts.FloatPrecision,
+		canonical:        opts.UseCanonical,
+		rawMessages:      opts.RawMessageBytes,
+		canonicalRaw:     opts.CanonicalRawMessages,
+		fieldName:        opts.FieldName,
+		distinctBools:    opts.DistinctBools,
+		fallback:         opts.Fallback,
+		ignoreEmpty:      opts.IgnoreEmptyCollections,
+		prune:            opts.Prune,
+		getters:          opts.UseGetters,
+		transformers:     opts.Transformers,
+		ignoreOpaque:     opts.IgnoreUnexportedStructs,
+		parallel:         opts.Parallel,
+		goStringer:       opts.UseGoStringer,
+		skipNaN:          opts.SkipNaN,
+		scalarCategories: opts.ScalarCategories,
+		nameTag:          opts.NameTag,
+		gobEncoder:       opts.UseGobEncoder,
+		nilAsMissing:     opts.TreatNilMapValuesAsMissing,
+		timeInstants:     opts.TimesAsInstants,
+		valuer:           opts.UseValuer,
+		merkle:           opts.Merkle,
+		nilPointers:      opts.NilPointersDistinct,
+		arrayLengths:     opts.ArrayLengths,
+		deterministic:    opts.Deterministic,
+		nilMarkers:       opts.IncludeNilMarker,
+		dedup:            opts.SliceDedup,
+		unexported:       opts.IncludeUnexported,
+		ignoreFuncs:      opts.IgnoreFuncs,
+		hashMarshaler:    opts.UseHashMarshaler,
+		sliceCap:         opts.IncludeSliceCap,
+		typeNames:        opts.TypeNames,
+		ignoreIfaces:     opts.IgnoreInterfaces,
+		numericStrings:   opts.NumericAsString,
+		numbersAsStrings: opts.NumbersMatchStrings,
+		urlStrings:       opts.URLsAsStrings,
+		registered:       registeredTransformers(),
+		visiting:         make(cycleSet),
 	}
-	return w.visit(reflect.ValueOf(v), nil)
+	w.transforming = len(w.transformers) > 0 || len(w.registered) > 0
+	w.hookValues = w.transforming || w.getters || w.canonical || w.valuer
+
+	return w
 }
 
 type walker struct {
-	format          Format
-	h               hash.Hash64
-	tag             string
-	zeronil         bool
-	ignorezerovalue bool
-	sets            bool
-	stringer        bool
+	format           Format
+	h                hash.Hash64
+	order            binary.ByteOrder
+	tag              string
+	zeronil          bool
+	ignorezerovalue  bool
+	sets             bool
+	stringer         bool
+	canonicalNumbers bool
+	ignoreSync       bool
+	orderedMaps      bool
+	namedTypes       bool
+	onIgnore         func(string, string)
+	includeTags      bool
+	funcsByPointer   bool
+	logger           func(string, reflect.Kind, int)
+	stringifyAll     bool
+	typedNils        bool
+	sortFields       bool
+	marshaler        func(interface{}) ([]byte, bool, error)
+	floatPrecision   int
+	canonical        bool
+	rawMessages      bool
+	canonicalRaw     bool
+	fieldName        func(reflect.StructField) (string, bool)
+	distinctBools    bool
+	fallback         func(reflect.Value) (uint64, bool, error)
+	ignoreEmpty      bool
+	prune            func(string) bool
+	getters          bool
+	transformers     map[reflect.Type]func(interface{}) interface{}
+	registered       map[reflect.Type]func(interface{}) interface{}
+	transforming     bool
+	ignoreOpaque     bool
+	parallel         bool
+	goStringer       bool
+	skipNaN          bool
+	scalarCategories bool
+	nameTag          string
+	gobEncoder       bool
+	nilAsMissing     bool
+	timeInstants     bool
+	valuer           bool
+	merkle           bool
+	nilPointers      bool
+	arrayLengths     bool
+	deterministic    bool
+	nilMarkers       bool
+	dedup            bool
+	unexported       bool
+	ignoreFuncs      bool
+	hashMarshaler    bool
+	sliceCap         bool
+	typeNames        map[reflect.Type]string
+	ignoreIfaces     []reflect.Type
+	numericStrings   bool
+	numbersAsStrings bool
+	urlStrings       bool
+	newHash          func() hash.Hash64
+	counter          *countingHasher
+
+	// path is the location of the value currently being visited
+	path []pathElem
+
+	// visiting are the pointers, maps and slices currently being visited
+	visiting cycleSet
+
+	// hookValues is set if values may come from transformers, getters or
+	// other hooks, in which case every value is checked for cycles.
+	hookValues bool
+
+	// getterTypes counts the structs of each type whose getters are
+	// being visited, to find getters that return their own type.
+	getterTypes map[reflect.Type]int
+
+	// pointers is the number of references to each pointer in the value,
+	// only set if SharePointers is enabled.
+	pointers map[cycleKey]int
+
+	// counts are the references to each pointer found so far while
+	// counting them for SharePointers, which is done by walking the value
+	// once before hashing it.
+	counts map[cycleKey]int
 }
 
 type visitOpts struct {
@@ -145,28 +1040,215 @@ type visitOpts struct {
 	// Information about the struct containing this field
 	Struct      interface{}
 	StructField string
+
+	// IgnoreKeys are the keys to skip if this is a map, from the
+	// "ignorekeys" tag of the field
+	IgnoreKeys map[string]struct{}
 }
 
 var timeType = reflect.TypeOf(time.Time{})
+var locationType = reflect.TypeOf(time.Location{})
+var locationPtrType = reflect.PtrTo(locationType)
+var rawBytesType = reflect.TypeOf(RawBytes(nil))
+var byteType = reflect.TypeOf(byte(0))
+var regexpType = reflect.TypeOf(regexp.Regexp{})
+var regexpPtrType = reflect.PtrTo(regexpType)
+var urlType = reflect.TypeOf(url.URL{})
+var urlPtrType = reflect.PtrTo(urlType)
+
+// basicTypes maps each basic kind to its predeclared type. This is used
+// to convert defined types to their underlying type.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:       reflect.TypeOf(false),
+	reflect.Int:        reflect.TypeOf(int(0)),
+	reflect.Int8:       reflect.TypeOf(int8(0)),
+	reflect.Int16:      reflect.TypeOf(int16(0)),
+	reflect.Int32:      reflect.TypeOf(int32(0)),
+	reflect.Int64:      reflect.TypeOf(int64(0)),
+	reflect.Uint:       reflect.TypeOf(uint(0)),
+	reflect.Uint8:      reflect.TypeOf(uint8(0)),
+	reflect.Uint16:     reflect.TypeOf(uint16(0)),
+	reflect.Uint32:     reflect.TypeOf(uint32(0)),
+	reflect.Uint64:     reflect.TypeOf(uint64(0)),
+	reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+	reflect.Float32:    reflect.TypeOf(float32(0)),
+	reflect.Float64:    reflect.TypeOf(float64(0)),
+	reflect.Complex64:  reflect.TypeOf(complex64(0)),
+	reflect.Complex128: reflect.TypeOf(complex128(0)),
+	reflect.String:     reflect.TypeOf(""),
+}
+
+// syncTypes are the sync primitives skipped by IgnoreSyncPrimitives.
+var syncTypes = map[reflect.Type]struct{}{
+	reflect.TypeOf(sync.Mutex{}):     {},
+	reflect.TypeOf(sync.RWMutex{}):   {},
+	reflect.TypeOf(sync.Once{}):      {},
+	reflect.TypeOf(sync.WaitGroup{}): {},
+	reflect.TypeOf(sync.Cond{}):      {},
+}
+
+// ignoredInterface returns true if t is one of the IgnoreInterfaces.
+func (w *walker) ignoredInterface(t reflect.Type) bool {
+	if t.Kind() != reflect.Interface {
+		return false
+	}
+
+	for _, it := range w.ignoreIfaces {
+		if t == it {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSyncPrimitive returns true if t is a sync primitive or a pointer to one.
+func isSyncPrimitive(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	_, ok := syncTypes[t]
+	return ok
+}
 
 func (w *walker) visit(v reflect.Value, opts *visitOpts) (uint64, error) {
-	t := reflect.TypeOf(0)
+	// Stop as soon as we've written too much
+	if w.counter != nil && w.counter.tooLarge() {
+		return 0, &ErrTooLarge{MaxBytes: w.counter.max}
+	}
+
+	if w.logger != nil {
+		start := w.counter.n
+		defer func() {
+			w.logger(w.pathString(), v.Kind(), w.counter.n-start)
+		}()
+	}
+
+	// Transformers have the final say over the value, and over every
+	// layer of pointers and interfaces within it below.
+	if w.transforming {
+		if fn := w.transformerOf(v, opts); fn != nil {
+			return w.visitTransformed(fn, v, opts)
+		}
+	}
+
+	// Give the marshaler first chance at the value
+	if w.marshaler != nil && v.IsValid() && v.CanInterface() {
+		b, ok, err := w.marshaler(v.Interface())
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return w.visitBytes(b)
+		}
+	}
+
+	if h, ok, err := w.visitHooks(v, opts); ok {
+		return h, err
+	}
 
 	// Loop since these can be wrapped in multiple layers of pointers
 	// and interfaces.
+	unwrapped := false
 	for {
+		if w.transforming {
+			if fn := w.transformerOf(v, opts); fn != nil {
+				return w.visitTransformed(fn, v, opts)
+			}
+		}
+
+		// The value of an interface gets the same hooks as any other
+		if unwrapped {
+			unwrapped = false
+			if h, ok, err := w.visitHooks(v, opts); ok {
+				return h, err
+			}
+		}
+
 		// If we have an interface, dereference it. We have to do this up
 		// here because it might be a nil in there and the check below must
 		// catch that.
 		if v.Kind() == reflect.Interface {
+			if w.typedNils && v.IsNil() {
+				return w.visitNilInterface(v.Type())
+			}
+			if w.typeNames != nil && !v.IsNil() {
+				return w.visitTypeName(v.Elem(), opts)
+			}
+
 			v = v.Elem()
+			unwrapped = true
 			continue
 		}
 
+		// Every kind of nil is the same marker if requested
+		if w.nilMarkers && isNil(v) {
+			return w.visitMarker(nilMarker)
+		}
+
 		if v.Kind() == reflect.Ptr {
-			if w.zeronil {
-				t = v.Type().Elem()
+			// Locations are hashed by name. A nil location is UTC, just
+			// like in the time package.
+			if v.Type() == locationPtrType && w.format != FormatV1 {
+				v = reflect.ValueOf(v.Interface().(*time.Location).String())
+				break
+			}
+
+			// Regexps are hashed by their pattern since the compiled form
+			// is unexported. A nil regexp is hashed as a marker so that it
+			// differs from every pattern, including the empty one.
+			if v.Type() == regexpPtrType && w.format != FormatV1 {
+				if v.IsNil() {
+					return w.visitMarker(nilMarker)
+				}
+
+				v = reflect.ValueOf(v.Interface().(*regexp.Regexp).String())
+				break
+			}
+
+			// URLs are hashed by their string form if requested, so that
+			// equivalent URLs hash the same however their fields are set.
+			if w.urlStrings && v.Type() == urlPtrType {
+				if v.IsNil() {
+					return w.visitMarker(nilMarker)
+				}
+
+				v = reflect.ValueOf(v.Interface().(*url.URL).String())
+				break
+			}
+
+			// A missing value differs from any present one if requested
+			if w.nilPointers && v.IsNil() {
+				return w.visitMarker(nilMarker)
+			}
+
+			// Detect values that refer to themselves
+			if !v.IsNil() && w.mayCycle(v.Type()) {
+				if !w.visiting.enter(v) {
+					return w.visitCycle(v)
+				}
+				defer w.visiting.leave(v)
+			}
+
+			if w.counts != nil && !w.countPointer(v) {
+				return 0, nil
+			}
+
+			if w.pointers != nil && !v.IsNil() {
+				if n := w.pointers[newCycleKey(v)]; n > 1 {
+					return w.visitShared(v.Elem(), n, opts)
+				}
 			}
+
+			// With ZeroNil, a nil pointer is the zero value of the type it
+			// points to. That may be a pointer or interface itself, so keep
+			// unwrapping it.
+			if w.zeronil && v.IsNil() {
+				v = reflect.Zero(v.Type().Elem())
+				continue
+			}
+
 			v = reflect.Indirect(v)
 			continue
 		}
@@ -174,19 +1256,47 @@ func (w *walker) visit(v reflect.Value, opts *visitOpts) (uint64, error) {
 		break
 	}
 
-	// If it is nil, treat it like a zero.
+	// If it is nil, treat it like a zero, unless nil is its own category.
 	if !v.IsValid() {
-		v = reflect.Zero(t)
+		if w.scalarCategories {
+			return w.visitMarker(nilMarker)
+		}
+
+		v = reflect.Zero(reflect.TypeOf(0))
+	}
+
+	// If we're rendering everything as text, do that now
+	if w.stringifyAll && v.Kind() != reflect.Struct {
+		if w.deterministic && formatsAddress(v, true) {
+			return 0, w.nondeterministic("formatted pointer")
+		}
+
+		v = reflect.ValueOf(fmt.Sprintf("%#v", v.Interface()))
+	}
+
+	// If this is a defined type with a basic underlying type, hash the
+	// underlying value together with the type name.
+	if w.namedTypes {
+		if t := v.Type(); t.PkgPath() != "" {
+			if basic, ok := basicTypes[t.Kind()]; ok {
+				return w.visitNamed(t, v.Convert(basic), opts)
+			}
+		}
 	}
 
 	// Binary writing can use raw ints, we have to convert to
-	// a sized-int, we'll choose the largest...
+	// a sized-int, we'll choose the largest. This also makes the hash
+	// independent of the platform's int size.
 	switch v.Kind() {
 	case reflect.Int:
 		v = reflect.ValueOf(int64(v.Int()))
-	case reflect.Uint:
+	case reflect.Uint, reflect.Uintptr:
 		v = reflect.ValueOf(uint64(v.Uint()))
 	case reflect.Bool:
+		if w.distinctBools || w.scalarCategories || w.numericStrings {
+			return w.visitBool(v.Bool())
+		}
+
 		var tmp int8
 		if v.Bool() {
 			tmp = 1
@@ -194,83 +1304,260 @@ func (w *walker) visit(v reflect.Value, opts *visitOpts) (uint64, error) {
 		v = reflect.ValueOf(tmp)
 	}
 
+	// If requested, collapse all numbers to a single representation so
+	// that values hash by magnitude rather than by type.
+	if w.canonicalNumbers {
+		switch v.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v = reflect.ValueOf(v.Int())
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if u := v.Uint(); u <= math.MaxInt64 {
+				v = reflect.ValueOf(int64(u))
+			} else {
+				v = reflect.ValueOf(u)
+			}
+		case reflect.Float32, reflect.Float64:
+			v = reflect.ValueOf(v.Float())
+		}
+	}
+
+	// If requested, round floats so that nearly equal values hash equal
+	if w.floatPrecision > 0 {
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := roundFloat(v.Float(), w.floatPrecision)
+			v = reflect.ValueOf(f).Convert(v.Type())
+		}
+	}
+
 	k := v.Kind()
 
+	// If requested, hash numbers by their decimal text instead
+	if w.numericStrings {
+		switch k {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return w.visitNumericString(strconv.FormatInt(v.Int(), 10))
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return w.visitNumericString(strconv.FormatUint(v.Uint(), 10))
+		case reflect.Float32:
+			return w.visitNumericString(strconv.FormatFloat(v.Float(), 'g', -1, 32))
+		case reflect.Float64:
+			return w.visitNumericString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+		}
+	}
+
 	// We can shortcut numeric values by directly binary writing them
 	if k >= reflect.Int && k <= reflect.Complex64 {
+		// Rounding floats normalizes NaN, but complex numbers aren't
+		if w.deterministic && isNaN(v) && (w.floatPrecision == 0 || k >= reflect.Complex64) {
+			return 0, w.nondeterministic("NaN")
+		}
+
 		// A direct hash calculation
 		w.h.Reset()
-		err := binary.Write(w.h, binary.LittleEndian, v.Interface())
+		if err := w.writeCategory(k); err != nil {
+			return 0, err
+		}
+
+		err := binary.Write(w.h, w.order, v.Interface())
+		return w.h.Sum64(), err
+	}
+
+	// Funcs can only be hashed by their identity
+	if k == reflect.Func && w.funcsByPointer {
+		if w.deterministic {
+			return 0, w.nondeterministic("func")
+		}
+
+		w.h.Reset()
+		err := binary.Write(w.h, w.order, uint64(v.Pointer()))
 		return w.h.Sum64(), err
 	}
 
+	// Otherwise funcs are all the same if they are ignored
+	if k == reflect.Func && w.ignoreFuncs {
+		w.ignored("func")
+		return w.visitMarker(funcMarker)
+	}
+
+	if v.Type() == rawMessageType && (w.rawMessages || w.canonicalRaw) {
+		return w.visitRawMessage(v.Bytes())
+	}
+
 	switch v.Type() {
 	case timeType:
 		w.h.Reset()
-		b, err := v.Interface().(time.Time).MarshalBinary()
+		t := v.Interface().(time.Time)
+		if w.timeInstants {
+			t = t.UTC()
+		} else if w.deterministic && t.Location() == time.Local {
+			return 0, w.nondeterministic("local time")
+		}
+
+		b, err := t.MarshalBinary()
 		if err != nil {
 			return 0, err
 		}
 
-		err = binary.Write(w.h, binary.LittleEndian, b)
+		err = binary.Write(w.h, w.order, b)
 		return w.h.Sum64(), err
+
+	case locationType:
+		if w.format == FormatV1 {
+			break
+		}
+
+		// We need the original pointer if we can get it, since the
+		// local location is lazily loaded.
+		var loc *time.Location
+		if v.CanAddr() {
+			loc = v.Addr().Interface().(*time.Location)
+		} else {
+			tmp := v.Interface().(time.Location)
+			loc = &tmp
+		}
+
+		return w.visit(reflect.ValueOf(loc.String()), nil)
+
+	case regexpType:
+		if w.format == FormatV1 {
+			break
+		}
+
+		var re *regexp.Regexp
+		if v.CanAddr() {
+			re = v.Addr().Interface().(*regexp.Regexp)
+		} else {
+			tmp := v.Interface().(regexp.Regexp)
+			re = &tmp
+		}
+
+		return w.visit(reflect.ValueOf(re.String()), nil)
+
+	case urlType:
+		if !w.urlStrings {
+			break
+		}
+
+		var u *url.URL
+		if v.CanAddr() {
+			u = v.Addr().Interface().(*url.URL)
+		} else {
+			tmp := v.Interface().(url.URL)
+			u = &tmp
+		}
+
+		return w.visit(reflect.ValueOf(u.String()), nil)
+
+	case rawBytesType:
+		return w.visitBytes(v.Bytes())
+
+	case hardwareAddrType, ipType, ipMaskType:
+		if w.format != FormatV1 {
+			return w.visitNetBytes(v)
+		}
+	}
+
+	// Atomic values are hashed by what they hold, since their state is
+	// unexported.
+	if k == reflect.Struct && v.Type().PkgPath() == atomicPkgPath && w.format != FormatV1 {
+		if h, ok, err := w.visitAtomic(v, opts); ok {
+			return h, err
+		}
 	}
 
 	switch k {
 	case reflect.Array:
+		// Byte arrays, such as UUIDs, are written all at once
+		if v.Type().Elem() == byteType && w.format != FormatV1 {
+			return w.visitByteArray(v)
+		}
+
 		var h uint64
 		l := v.Len()
+		if w.arrayLengths {
+			mh, err := w.visitMarker(arrayMarker)
+			if err != nil {
+				return 0, err
+			}
+
+			h = hashUpdateOrdered(w.h, w.order, mh, uint64(l))
+		}
+
 		for i := 0; i < l; i++ {
+			w.pushIndex(i)
+			if w.pruned() || w.skippedNaN(v.Index(i)) {
+				w.popPath()
+				continue
+			}
+
 			current, err := w.visit(v.Index(i), nil)
 			if err != nil {
 				return 0, err
 			}
+			w.popPath()
 
-			h = hashUpdateOrdered(w.h, h, current)
+			h = hashUpdateOrdered(w.h, w.order, h, current)
 		}
 
 		return h, nil
 
 	case reflect.Map:
-		var includeMap IncludableMap
+		if w.mayCycle(v.Type()) {
+			if !w.visiting.enter(v) {
+				return w.visitCycle(v)
+			}
+			defer w.visiting.leave(v)
+		}
+
+		var mv mapVisit
+		if opts != nil {
+			mv.ignoreKeys = opts.IgnoreKeys
+		}
+
+		// Pointer keys are hashed by what they point to, so distinct keys
+		// can hash the same. FormatV1 XOR-ed them regardless.
+		mv.sortEntries = w.orderedMaps ||
+			(v.Type().Key().Kind() == reflect.Ptr && w.format != FormatV1)
 		if opts != nil && opts.Struct != nil {
-			if v, ok := opts.Struct.(IncludableMap); ok {
-				includeMap = v
+			mv.field = opts.StructField
+			if v, ok := opts.Struct.(TransformableMap); ok {
+				mv.transform = v
+			} else if v, ok := opts.Struct.(IncludableMap); ok {
+				mv.include = v
 			}
 		}
 
+		// If this map is a set or multiset, then its values are too.
+		// FormatV1 didn't, so we maintain that for compatibility.
+		if opts != nil && (opts.Flags&(visitFlagSet|visitFlagMultiset)) != 0 && w.format != FormatV1 {
+			mv.valueOpts = &visitOpts{Flags: opts.Flags & (visitFlagSet | visitFlagMultiset)}
+		}
+
 		// Build the hash for the map. We do this by XOR-ing all the key
 		// and value hashes. This makes it deterministic despite ordering.
+		// If we want ordered maps, we collect the entries instead and
+		// hash them after sorting.
 		var h uint64
-		for _, k := range v.MapKeys() {
-			v := v.MapIndex(k)
-			if includeMap != nil {
-				incl, err := includeMap.HashIncludeMap(
-					opts.StructField, k.Interface(), v.Interface())
-				if err != nil {
-					return 0, err
-				}
-				if !incl {
-					continue
-				}
-			}
-
-			kh, err := w.visit(k, nil)
-			if err != nil {
-				return 0, err
-			}
-			vh, err := w.visit(v, nil)
-			if err != nil {
-				return 0, err
-			}
+		var entries []mapEntryHash
+		var fast bool
+		var err error
+		if w.canParallel(v.Len()) {
+			h, entries, err = w.visitMapParallel(v, v.MapKeys(), &mv)
+		} else if h, fast, err = w.visitMapFast(v, &mv); !fast && err == nil {
+			h, entries, err = w.visitMapEntries(v, v.MapKeys(), &mv)
+		}
+		if err != nil {
+			return 0, err
+		}
 
-			fieldHash := hashUpdateOrdered(w.h, kh, vh)
-			h = hashUpdateUnordered(h, fieldHash)
+		if mv.sortEntries {
+			return hashOrderedEntries(w.h, w.order, entries), nil
 		}
 
 		if w.format != FormatV1 {
 			// Important: read the docs for hashFinishUnordered
-			h = hashFinishUnordered(w.h, h)
+			h = hashFinishUnordered(w.h, w.order, h)
 		}
 
 		return h, nil
@@ -288,9 +1575,10 @@ func (w *walker) visit(v reflect.Value, opts *visitOpts) (uint64, error) {
 
 		// If we can address this value, check if the pointer value
 		// implements our interfaces and use that if so.
+		var parentptr interface{}
 		if v.CanAddr() {
 			vptr := v.Addr()
-			parentptr := vptr.Interface()
+			parentptr = vptr.Interface()
 			if impl, ok := parentptr.(Includable); ok {
 				include = impl
 			}
@@ -300,139 +1588,1296 @@ func (w *walker) visit(v reflect.Value, opts *visitOpts) (uint64, error) {
 			}
 		}
 
+		// Collections that can range over their entries in order are
+		// hashed in that order, and others like maps.
+		if impl, ok := parent.(OrderedRanger); ok {
+			return w.visitOrderedRanger(impl)
+		}
+		if impl, ok := parentptr.(OrderedRanger); ok {
+			return w.visitOrderedRanger(impl)
+		}
+		if impl, ok := parent.(Ranger); ok {
+			return w.visitRanger(impl)
+		}
+		if impl, ok := parentptr.(Ranger); ok {
+			return w.visitRanger(impl)
+		}
+
 		t := v.Type()
-		h, err := w.visit(reflect.ValueOf(t.Name()), nil)
+		name := t.Name()
+		if w.namedTypes && t.PkgPath() != "" {
+			name = t.PkgPath() + "." + name
+		}
+
+		h, err := w.visit(reflect.ValueOf(name), nil)
 		if err != nil {
 			return 0, err
 		}
 
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			if innerV := v.Field(i); v.CanSet() || t.Field(i).Name != "_" {
-				var f visitFlag
-				fieldType := t.Field(i)
-				if fieldType.PkgPath != "" {
-					// Unexported
-					continue
-				}
-
-				tag := fieldType.Tag.Get(w.tag)
-				if tag == "ignore" || tag == "-" {
-					// Ignore this field
-					continue
-				}
+		if onlyUnexported(t) && !w.unexported {
+			if w.getters {
+				return w.visitGetters(v, h)
+			}
 
-				if w.ignorezerovalue {
-					if innerV.IsZero() {
-						continue
-					}
+			if w.ignoreOpaque {
+				w.ignored("opaque")
+				mh, err := w.visitMarker(opaqueMarker)
+				if err != nil {
+					return 0, err
 				}
 
-				// if string is set, use the string value
-				if tag == "string" || w.stringer {
-					if impl, ok := innerV.Interface().(fmt.Stringer); ok {
-						innerV = reflect.ValueOf(impl.String())
-					} else if tag == "string" {
-						// We only show this error if the tag explicitly
-						// requests a stringer.
-						return 0, &ErrNotStringer{
-							Field: v.Type().Field(i).Name,
-						}
-					}
-				}
+				return hashUpdateOrdered(w.h, w.order, h, mh), nil
+			}
 
-				// Check if we implement includable and check it
-				if include != nil {
-					incl, err := include.HashInclude(fieldType.Name, innerV)
-					if err != nil {
-						return 0, err
-					}
-					if !incl {
-						continue
-					}
+			if w.onIgnore != nil {
+				if _, ok := stringerOf(v); ok {
+					w.ignored("stringer")
 				}
+			}
+		}
 
-				switch tag {
-				case "set":
-					f |= visitFlagSet
-				}
+		return w.visitFields(v, parent, include, h)
 
-				kh, err := w.visit(reflect.ValueOf(fieldType.Name), nil)
+	case reflect.Slice:
+		if w.mayCycle(v.Type()) {
+			if !w.visiting.enter(v) {
+				return w.visitCycle(v)
+			}
+			defer w.visiting.leave(v)
+		}
+
+		// We have five behaviors here. If it isn't a set, then we just
+		// visit all the elements. If it is a set, then we do a deterministic
+		// hash code, ignoring duplicates. If it is a multiset, we sort
+		// the element hashes so duplicates still count. If it is rotation
+		// invariant, we rotate the element hashes to a canonical start. If
+		// it is deduplicated, we visit the elements skipping duplicates.
+		var h uint64
+		var set, multiset, rotation, dedup bool
+		if opts != nil {
+			set = (opts.Flags & visitFlagSet) != 0
+			multiset = (opts.Flags & visitFlagMultiset) != 0
+			rotation = (opts.Flags & visitFlagRotation) != 0
+			dedup = (opts.Flags & visitFlagDedup) != 0
+		}
+		if w.dedup && !set && !multiset && !rotation && !w.sets {
+			dedup = true
+		}
+
+		// Tags take precedence over SlicesAsSets
+		sets := w.sets && !dedup
+
+		// Duplicates would cancel each other out with XOR, so we skip
+		// them. FormatV1 didn't, so we maintain that for compatibility.
+		var seen map[uint64]struct{}
+		if ((set || sets) && w.format != FormatV1) || dedup {
+			seen = make(map[uint64]struct{})
+		}
+
+		var elems []uint64
+		l := v.Len()
+		for i := 0; i < l; i++ {
+			w.pushIndex(i)
+			if w.pruned() || w.skippedNaN(v.Index(i)) {
+				w.popPath()
+				continue
+			}
+
+			current, err := w.visit(v.Index(i), nil)
+			if err != nil {
+				return 0, err
+			}
+			w.popPath()
+
+			if dedup {
+				if _, ok := seen[current]; ok {
+					continue
+				}
+				seen[current] = struct{}{}
+			}
+
+			switch {
+			case multiset, rotation:
+				elems = append(elems, current)
+
+			case w.merkle && !set && !sets:
+				elems = append(elems, current)
+
+			case set || sets:
+				if seen != nil {
+					if _, ok := seen[current]; ok {
+						continue
+					}
+					seen[current] = struct{}{}
+				}
+
+				h = hashUpdateUnordered(h, current)
+
+			default:
+				h = hashUpdateOrdered(w.h, w.order, h, current)
+			}
+		}
+
+		switch {
+		case multiset:
+			h = hashSorted(w.h, w.order, elems)
+
+		case w.merkle && !set && !sets && !rotation:
+			h = merkleRoot(w.h, w.order, merkleLevels(w.h, w.order, elems))
+
+		case rotation:
+			start := leastRotation(elems)
+			for i := range elems {
+				h = hashUpdateOrdered(w.h, w.order, h, elems[(start+i)%len(elems)])
+			}
+
+		case set && w.format != FormatV1:
+			// Important: read the docs for hashFinishUnordered
+			h = hashFinishUnordered(w.h, w.order, h)
+		}
+
+		if w.sliceCap {
+			h = hashUpdateOrdered(w.h, w.order, h, uint64(v.Cap()))
+		}
+
+		return h, nil
+
+	case reflect.String:
+		// Directly hash
+		w.h.Reset()
+		if err := w.writeCategory(k); err != nil {
+			return 0, err
+		}
+
+		_, err := w.h.Write([]byte(v.String()))
+		return w.h.Sum64(), err
+
+	default:
+		if w.fallback != nil {
+			h, handled, err := w.fallback(v)
+			if err != nil {
+				return 0, err
+			}
+			if handled {
+				return h, nil
+			}
+		}
+
+		return 0, &ErrUnsupportedKind{Kind: k, Path: w.pathString()}
+	}
+
+}
+
+// sortedFieldsCache caches the result of sortedFields by type.
+var sortedFieldsCache sync.Map
+
+// sortedFields returns the indexes of the fields of the struct type t,
+// sorted by field name.
+func sortedFields(t reflect.Type) []int {
+	if order, ok := sortedFieldsCache.Load(t); ok {
+		return order.([]int)
+	}
+
+	order := make([]int, t.NumField())
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return t.Field(order[i]).Name < t.Field(order[j]).Name
+	})
+
+	sortedFieldsCache.Store(t, order)
+	return order
+}
+
+// roundFloat rounds f to the given number of decimal places. Negative
+// zero becomes zero and every NaN becomes the same NaN.
+func roundFloat(f float64, precision int) float64 {
+	if math.IsNaN(f) {
+		return math.NaN()
+	}
+
+	// Values too large to scale are already more coarse than the
+	// requested precision.
+	p := math.Pow10(precision)
+	if scaled := f * p; !math.IsInf(scaled, 0) {
+		f = math.Round(scaled) / p
+	}
+
+	if f == 0 {
+		// Normalize negative zero
+		return 0
+	}
+
+	return f
+}
+
+// indirectValue dereferences v through any pointers and interfaces,
+// stopping at the first nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v
+		}
+
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// isNil returns true if v is invalid or nil, or an interface holding a
+// nil value.
+func isNil(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// taggedName returns the name of the field f given by the tag key, which
+// is everything before the first comma as with encoding/json. If the tag
+// doesn't give a name, or the name is "-", the Go field name is returned.
+func taggedName(f reflect.StructField, key string) string {
+	name := f.Tag.Get(key)
+	if i := strings.IndexByte(name, ','); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "-" {
+		return f.Name
+	}
+
+	return name
+}
+
+// bytesOf returns the contents of v, which must be a byte slice or array
+// or a pointer to one. A nil pointer or slice has no contents.
+func bytesOf(v reflect.Value) ([]byte, bool) {
+	v = indirectValue(v)
+	if v.Kind() == reflect.Ptr {
+		// A nil pointer, so check what it would point to
+		switch t := v.Type().Elem(); t.Kind() {
+		case reflect.Slice, reflect.Array:
+			return nil, t.Elem().Kind() == reflect.Uint8
+		}
+
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false
+		}
+
+		return v.Bytes(), true
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false
+		}
+
+		b := make([]byte, v.Len())
+		for i := range b {
+			b[i] = byte(v.Index(i).Uint())
+		}
+
+		return b, true
+	}
+
+	return nil, false
+}
+
+// skippedNaN returns true if SkipNaN is set and v is a NaN, which is
+// reported to OnIgnore.
+func (w *walker) skippedNaN(v reflect.Value) bool {
+	if !w.skipNaN || !isNaN(indirectValue(v)) {
+		return false
+	}
+
+	w.ignored("nan")
+	return true
+}
+
+// nondeterministic returns the error for the value at the current path,
+// which can't be hashed with Deterministic.
+func (w *walker) nondeterministic(reason string) error {
+	return &ErrNondeterministic{Reason: reason, Path: w.pathString()}
+}
+
+// formatsAddress returns true if formatting v with %#v prints a memory
+// address, which differs between runs. That is any pointer, func, chan or
+// unsafe pointer within v, except a pointer at the top to a value that is
+// printed in place, such as &T{...}.
+func formatsAddress(v reflect.Value, top bool) bool {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return false
+		}
+
+		switch v.Elem().Kind() {
+		case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+			if top {
+				return formatsAddress(v.Elem(), false)
+			}
+		}
+
+		return true
+
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return !v.IsNil()
+
+	case reflect.Interface:
+		return !v.IsNil() && formatsAddress(v.Elem(), top)
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if formatsAddress(v.Field(i), false) {
+				return true
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if formatsAddress(v.Index(i), false) {
+				return true
+			}
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if formatsAddress(iter.Key(), false) || formatsAddress(iter.Value(), false) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isNaN returns true if v is a float that is NaN, or a complex number with
+// a part that is NaN.
+func isNaN(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return math.IsNaN(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return math.IsNaN(real(c)) || math.IsNaN(imag(c))
+	default:
+		return false
+	}
+}
+
+// ignored reports the value at the current path to OnIgnore, if set.
+func (w *walker) ignored(reason string) {
+	if w.onIgnore != nil {
+		w.onIgnore(w.pathString(), reason)
+	}
+}
+
+// pruned returns true if Prune is set and returns true for the current
+// path, which is reported to OnIgnore.
+func (w *walker) pruned() bool {
+	if w.prune == nil {
+		return false
+	}
+
+	path := w.pathString()
+	if !w.prune(path) {
+		return false
+	}
+
+	if w.onIgnore != nil {
+		w.onIgnore(path, "prune")
+	}
+
+	return true
+}
+
+// ignoredField reports the struct field with the given name to OnIgnore,
+// if set.
+func (w *walker) ignoredField(name, reason string) {
+	if w.onIgnore != nil {
+		w.pushField(name)
+		w.ignored(reason)
+		w.popPath()
+	}
+}
+
+// mapVisit holds how the entries of a map are visited.
+type mapVisit struct {
+	// transform and include are the TransformableMap or IncludableMap
+	// implementation of the struct containing the map, if any, and field
+	// is the name of the map within it.
+	transform TransformableMap
+	include   IncludableMap
+	field     string
+
+	// valueOpts are the options used to visit the values
+	valueOpts *visitOpts
+
+	// ignoreKeys are the string keys to skip
+	ignoreKeys map[string]struct{}
+
+	// sortEntries collects the entries to hash them sorted rather than
+	// XOR-ing them, with OrderedMaps or when distinct keys can hash the
+	// same, since equal entries would cancel each other out.
+	sortEntries bool
+}
+
+// visitMapEntries hashes the entries of the map m with the given keys. It
+// returns the XOR of the entry hashes, or with mv.sortEntries, the entries
+// themselves.
+func (w *walker) visitMapEntries(m reflect.Value, keys []reflect.Value, mv *mapVisit) (uint64, []mapEntryHash, error) {
+	var h uint64
+	var entries []mapEntryHash
+	for _, k := range keys {
+		v := m.MapIndex(k)
+		w.pushKey(k)
+		if w.pruned() || w.skippedNaN(k) || w.skippedNaN(v) {
+			w.popPath()
+			continue
+		}
+
+		if mv.ignoreKeys != nil {
+			if _, ok := mv.ignoreKeys[k.String()]; ok {
+				w.ignored("tag")
+				w.popPath()
+				continue
+			}
+		}
+
+		if mv.transform != nil {
+			nk, nv, incl, err := mv.transform.HashMapEntry(
+				mv.field, k.Interface(), v.Interface())
+			if err != nil {
+				return 0, nil, err
+			}
+			if !incl {
+				w.ignored("include")
+				w.popPath()
+				continue
+			}
+
+			k = reflect.ValueOf(nk)
+			v = reflect.ValueOf(nv)
+		} else if mv.include != nil {
+			incl, err := mv.include.HashIncludeMap(
+				mv.field, k.Interface(), v.Interface())
+			if err != nil {
+				return 0, nil, err
+			}
+			if !incl {
+				w.ignored("include")
+				w.popPath()
+				continue
+			}
+		}
+
+		if w.nilAsMissing && isNil(v) {
+			w.ignored("nil")
+			w.popPath()
+			continue
+		}
+
+		kh, err := w.visit(k, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		vh, err := w.visit(v, mv.valueOpts)
+		if err != nil {
+			return 0, nil, err
+		}
+		w.popPath()
+
+		if mv.sortEntries {
+			entries = append(entries, mapEntryHash{Key: kh, Value: vh})
+			continue
+		}
+
+		fieldHash := hashUpdateOrdered(w.h, w.order, kh, vh)
+		h = hashUpdateUnordered(h, fieldHash)
+	}
+
+	return h, entries, nil
+}
+
+// visitFields hashes the fields of the struct v, folding them into h.
+// The parent and include are the struct value and its Includable
+// implementation, if any.
+func (w *walker) visitFields(v reflect.Value, parent interface{}, include Includable, h uint64) (uint64, error) {
+	t := v.Type()
+
+	var order []int
+	if w.sortFields {
+		order = sortedFields(t)
+	}
+
+	// Unexported fields can only be read from an addressable copy
+	if w.unexported && !v.CanAddr() {
+		c := reflect.New(t).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	l := v.NumField()
+	for n := 0; n < l; n++ {
+		i := n
+		if order != nil {
+			i = order[n]
+		}
+
+		if innerV := v.Field(i); v.CanSet() || t.Field(i).Name != "_" {
+			var f visitFlag
+			fieldType := t.Field(i)
+			if fieldType.PkgPath != "" {
+				// Unexported
+				if !w.unexported || fieldType.Name == "_" {
+					w.ignoredField(fieldType.Name, "unexported")
+					continue
+				}
+
+				innerV = exportedField(v, i)
+			}
+
+			tag := fieldType.Tag.Get(w.tag)
+			if tag == "ignore" || tag == "-" {
+				// Ignore this field
+				w.ignoredField(fieldType.Name, "tag")
+				continue
+			}
+
+			name := fieldType.Name
+			if w.nameTag != "" {
+				name = taggedName(fieldType, w.nameTag)
+			}
+			if w.fieldName != nil {
+				var skip bool
+				if name, skip = w.fieldName(fieldType); skip {
+					w.ignoredField(fieldType.Name, "name")
+					continue
+				}
+			}
+
+			// if redact is set, the field counts but its value doesn't
+			if tag == "redact" {
+				w.ignoredField(fieldType.Name, "redact")
+				kh, err := w.visitFieldKey(name, fieldType)
 				if err != nil {
 					return 0, err
 				}
+				vh, err := w.visitMarker(redactedMarker)
+				if err != nil {
+					return 0, err
+				}
+
+				fieldHash := hashUpdateOrdered(w.h, w.order, kh, vh)
+				h = hashUpdateUnordered(h, fieldHash)
+				continue
+			}
+
+			if w.ignoreFuncs && !w.funcsByPointer && fieldType.Type.Kind() == reflect.Func {
+				w.ignoredField(fieldType.Name, "func")
+				continue
+			}
+
+			if w.ignoredInterface(fieldType.Type) {
+				w.ignoredField(fieldType.Name, "interface")
+				continue
+			}
+
+			if w.ignoreSync && isSyncPrimitive(fieldType.Type) {
+				w.ignoredField(fieldType.Name, "sync")
+				continue
+			}
+
+			if w.ignorezerovalue {
+				if innerV.IsZero() {
+					w.ignoredField(fieldType.Name, "zero")
+					continue
+				}
+			}
+
+			if w.ignoreEmpty {
+				switch innerV.Kind() {
+				case reflect.Slice, reflect.Map:
+					if innerV.Len() == 0 {
+						w.ignoredField(fieldType.Name, "empty")
+						continue
+					}
+				}
+			}
+
+			if w.prune != nil || w.skipNaN {
+				w.pushField(fieldType.Name)
+				skip := w.pruned() || w.skippedNaN(innerV)
+				w.popPath()
+				if skip {
+					continue
+				}
+			}
+
+			// if inline is set, hash the fields as if they were ours
+			if tag == "inline" {
+				inner := indirectValue(innerV)
+				if inner.Kind() == reflect.Ptr {
+					inner = reflect.Zero(inner.Type().Elem())
+				}
+				if inner.Kind() != reflect.Struct {
+					return 0, &ErrNotStruct{Field: fieldType.Name}
+				}
+
+				var err error
+				w.pushField(fieldType.Name)
+				h, err = w.visitFields(inner, inner.Interface(), includableOf(inner), h)
+				if err != nil {
+					return 0, err
+				}
+				w.popPath()
+				continue
+			}
+
+			// if string is set, use the string value
+			if tag == "string" || w.stringer {
+				// Only the tag uses String methods with pointer receivers,
+				// since UseStringer never did and hashes must not change.
+				impl, ok := innerV.Interface().(fmt.Stringer)
+				if tag == "string" {
+					impl, ok = stringerOf(innerV)
+				}
+
+				if ok {
+					innerV = reflect.ValueOf(impl.String())
+				} else if tag == "string" {
+					// We only show this error if the tag explicitly
+					// requests a stringer.
+					return 0, &ErrNotStringer{
+						Field: v.Type().Field(i).Name,
+					}
+				}
+			}
+
+			// if bytes is set, hash the contents as a single blob
+			if tag == "bytes" {
+				b, ok := bytesOf(innerV)
+				if !ok {
+					return 0, &ErrNotBytes{
+						Field: fieldType.Name,
+					}
+				}
+
+				innerV = reflect.ValueOf(RawBytes(b))
+			}
+
+			// if gostring is set, use the Go syntax representation
+			if tag == "gostring" {
+				innerV = indirectValue(innerV)
+				if w.deterministic && formatsAddress(innerV, true) {
+					w.pushField(fieldType.Name)
+					err := w.nondeterministic("formatted pointer")
+					w.popPath()
+					return 0, err
+				}
+
+				innerV = reflect.ValueOf(fmt.Sprintf("%#v", innerV.Interface()))
+			}
+
+			// Check if we implement includable and check it
+			if include != nil {
+				incl, err := include.HashInclude(fieldType.Name, innerV)
+				if err != nil {
+					return 0, err
+				}
+				if !incl {
+					w.ignoredField(fieldType.Name, "include")
+					continue
+				}
+			}
+
+			switch tag {
+			case "set":
+				f |= visitFlagSet
+			case "multiset":
+				f |= visitFlagMultiset
+			case "rotinvariant":
+				f |= visitFlagRotation
+			case "dedup":
+				f |= visitFlagDedup
+			}
+
+			kh, err := w.visitFieldKey(name, fieldType)
+			if err != nil {
+				return 0, err
+			}
+
+			// if precision is set, round the floats within the field
+			precision := w.floatPrecision
+			if strings.HasPrefix(tag, "precision=") {
+				p, err := strconv.Atoi(strings.TrimPrefix(tag, "precision="))
+				if err != nil || p <= 0 {
+					return 0, &ErrInvalidTag{
+						Field: fieldType.Name,
+						Tag:   tag,
+					}
+				}
+
+				w.floatPrecision = p
+			}
+
+			// if ignorekeys is set, skip those keys of the map
+			var ignoreKeys map[string]struct{}
+			if strings.HasPrefix(tag, "ignorekeys=") {
+				mt := fieldType.Type
+				for mt.Kind() == reflect.Ptr {
+					mt = mt.Elem()
+				}
+				if mt.Kind() != reflect.Map || mt.Key().Kind() != reflect.String {
+					return 0, &ErrInvalidTag{
+						Field: fieldType.Name,
+						Tag:   tag,
+					}
+				}
+
+				ignoreKeys = make(map[string]struct{})
+				for _, k := range strings.Split(strings.TrimPrefix(tag, "ignorekeys="), ",") {
+					ignoreKeys[k] = struct{}{}
+				}
+			}
+
+			w.pushField(fieldType.Name)
+			vh, err := w.visit(innerV, &visitOpts{
+				Flags:       f,
+				Struct:      parent,
+				StructField: fieldType.Name,
+				IgnoreKeys:  ignoreKeys,
+			})
+			if err != nil {
+				return 0, err
+			}
+			w.popPath()
+			w.floatPrecision = precision
+
+			fieldHash := hashUpdateOrdered(w.h, w.order, kh, vh)
+			h = hashUpdateUnordered(h, fieldHash)
+		}
+
+		if w.format != FormatV1 {
+			// Important: read the docs for hashFinishUnordered
+			h = hashFinishUnordered(w.h, w.order, h)
+		}
+	}
 
-				vh, err := w.visit(innerV, &visitOpts{
-					Flags:       f,
-					Struct:      parent,
-					StructField: fieldType.Name,
-				})
-				if err != nil {
-					return 0, err
-				}
+	return h, nil
+}
 
-				fieldHash := hashUpdateOrdered(w.h, kh, vh)
-				h = hashUpdateUnordered(h, fieldHash)
+// visitFieldKey hashes the name of a struct field, which is hashed
+// together with its value. With IncludeTags, this includes its tag.
+func (w *walker) visitFieldKey(name string, field reflect.StructField) (uint64, error) {
+	kh, err := w.visit(reflect.ValueOf(name), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if w.includeTags && field.Tag != "" {
+		th, err := w.visit(reflect.ValueOf(string(field.Tag)), nil)
+		if err != nil {
+			return 0, err
+		}
+
+		kh = hashUpdateOrdered(w.h, w.order, kh, th)
+	}
+
+	return kh, nil
+}
+
+// visitGetters hashes the struct v by the results of its getter methods,
+// folding them into h. See UseGetters for how getters are selected.
+func (w *walker) visitGetters(v reflect.Value, h uint64) (uint64, error) {
+	// A struct can't hold a value of its own type, so one returned by its
+	// own getters has getters that return another one, and so on forever.
+	// Those returned by pointer are ended by nil like any other.
+	t := v.Type()
+	if w.getterTypes[t] > 0 && !v.CanAddr() {
+		return 0, &ErrGetterCycle{Type: t, Path: w.pathString()}
+	}
+	if w.getterTypes == nil {
+		w.getterTypes = make(map[reflect.Type]int)
+	}
+	w.getterTypes[t]++
+	defer func() { w.getterTypes[t]-- }()
+
+	recv := v
+	if v.CanAddr() {
+		recv = v.Addr()
+	}
+
+	rt := recv.Type()
+	for i := 0; i < rt.NumMethod(); i++ {
+		m := rt.Method(i)
+		if !isGetter(m) {
+			continue
+		}
+
+		name := strings.TrimPrefix(m.Name, "Get")
+		kh, err := w.visit(reflect.ValueOf(name), nil)
+		if err != nil {
+			return 0, err
+		}
+
+		w.pushField(name)
+		vh, err := w.visit(recv.Method(i).Call(nil)[0], nil)
+		if err != nil {
+			return 0, err
+		}
+		w.popPath()
+
+		fieldHash := hashUpdateOrdered(w.h, w.order, kh, vh)
+		h = hashUpdateUnordered(h, fieldHash)
+		if w.format != FormatV1 {
+			// Important: read the docs for hashFinishUnordered
+			h = hashFinishUnordered(w.h, w.order, h)
+		}
+	}
+
+	return h, nil
+}
+
+// isGetter returns true if the method m is a getter: an exported method
+// named Get followed by a name, taking no arguments and returning a single
+// value.
+func isGetter(m reflect.Method) bool {
+	return m.PkgPath == "" &&
+		len(m.Name) > len("Get") &&
+		strings.HasPrefix(m.Name, "Get") &&
+		m.Type.NumIn() == 1 &&
+		m.Type.NumOut() == 1
+}
+
+// canonicalizerOf returns the Canonicalizer implementation of v, or of a
+// pointer to it if v is addressable.
+func canonicalizerOf(v reflect.Value) (Canonicalizer, bool) {
+	impl, ok := implementationOf(v, canonicalizerType)
+	if !ok {
+		return nil, false
+	}
+
+	return impl.(Canonicalizer), true
+}
+
+// goStringerOf returns the fmt.GoStringer implementation of v, or of a
+// pointer to it if v is addressable.
+func goStringerOf(v reflect.Value) (fmt.GoStringer, bool) {
+	impl, ok := implementationOf(v, goStringerType)
+	if !ok {
+		return nil, false
+	}
+
+	return impl.(fmt.GoStringer), true
+}
+
+// gobEncoderOf returns the gob.GobEncoder implementation of v, or of a
+// pointer to it if v is addressable.
+func gobEncoderOf(v reflect.Value) (gob.GobEncoder, bool) {
+	impl, ok := implementationOf(v, gobEncoderType)
+	if !ok {
+		return nil, false
+	}
+
+	return impl.(gob.GobEncoder), true
+}
+
+// valuerOf returns the driver.Valuer implementation of v, or of a pointer
+// to it if v is addressable.
+func valuerOf(v reflect.Value) (driver.Valuer, bool) {
+	impl, ok := implementationOf(v, valuerType)
+	if !ok {
+		return nil, false
+	}
+
+	return impl.(driver.Valuer), true
+}
+
+// hashMarshalerOf returns the HashMarshaler implementation of v, or of a
+// pointer to it if v is addressable.
+func hashMarshalerOf(v reflect.Value) (HashMarshaler, bool) {
+	impl, ok := implementationOf(v, hashMarshalerType)
+	if !ok {
+		return nil, false
+	}
+
+	return impl.(HashMarshaler), true
+}
+
+var canonicalizerType = reflect.TypeOf((*Canonicalizer)(nil)).Elem()
+var goStringerType = reflect.TypeOf((*fmt.GoStringer)(nil)).Elem()
+var gobEncoderType = reflect.TypeOf((*gob.GobEncoder)(nil)).Elem()
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+var hashMarshalerType = reflect.TypeOf((*HashMarshaler)(nil)).Elem()
+
+// implementationOf returns v, or a pointer to it if v is addressable, as
+// the interface type iface if either implements it. Nil pointers and
+// interfaces are never returned, since calling a value method through them
+// would panic.
+func implementationOf(v reflect.Value, iface reflect.Type) (interface{}, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+
+	if v.Type().Implements(iface) {
+		return v.Interface(), true
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(iface) {
+		return v.Addr().Interface(), true
+	}
+
+	return nil, false
+}
+
+// stringerOf returns the fmt.Stringer implementation of v, or of a pointer
+// to it if v is addressable.
+func stringerOf(v reflect.Value) (fmt.Stringer, bool) {
+	if impl, ok := v.Interface().(fmt.Stringer); ok {
+		return impl, true
+	}
+
+	if v.CanAddr() {
+		if impl, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return impl, true
+		}
+	}
+
+	return nil, false
+}
+
+// onlyUnexported returns true if the struct type t has fields but none of
+// them are exported.
+func onlyUnexported(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return false
+		}
+	}
+
+	return t.NumField() > 0
+}
+
+// includableOf returns the Includable implementation of the struct v, or
+// of a pointer to it if v is addressable.
+func includableOf(v reflect.Value) Includable {
+	if v.CanAddr() {
+		if impl, ok := v.Addr().Interface().(Includable); ok {
+			return impl
+		}
+	}
+
+	impl, _ := v.Interface().(Includable)
+	return impl
+}
+
+// visitRanger hashes the entries of r exactly like the entries of a map,
+// so the result doesn't depend on the order they are ranged over.
+func (w *walker) visitRanger(r Ranger) (uint64, error) {
+	var h uint64
+	var entries []mapEntryHash
+	var err error
+	r.Range(func(k, v interface{}) bool {
+		var kh, vh uint64
+		kh, err = w.visit(reflect.ValueOf(k), nil)
+		if err != nil {
+			return false
+		}
+		vh, err = w.visit(reflect.ValueOf(v), nil)
+		if err != nil {
+			return false
+		}
+
+		if w.orderedMaps {
+			entries = append(entries, mapEntryHash{Key: kh, Value: vh})
+			return true
+		}
+
+		fieldHash := hashUpdateOrdered(w.h, w.order, kh, vh)
+		h = hashUpdateUnordered(h, fieldHash)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if w.orderedMaps {
+		return hashOrderedEntries(w.h, w.order, entries), nil
+	}
+
+	if w.format != FormatV1 {
+		// Important: read the docs for hashFinishUnordered
+		h = hashFinishUnordered(w.h, w.order, h)
+	}
+
+	return h, nil
+}
+
+// visitOrderedRanger hashes the entries of r in the order they are ranged
+// over.
+func (w *walker) visitOrderedRanger(r OrderedRanger) (uint64, error) {
+	var h uint64
+	var err error
+	r.RangeOrdered(func(k, v interface{}) bool {
+		var kh, vh uint64
+		kh, err = w.visit(reflect.ValueOf(k), nil)
+		if err != nil {
+			return false
+		}
+		vh, err = w.visit(reflect.ValueOf(v), nil)
+		if err != nil {
+			return false
+		}
+
+		h = hashUpdateOrdered(w.h, w.order, h, hashUpdateOrdered(w.h, w.order, kh, vh))
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return h, nil
+}
+
+// visitBytes hashes b directly. The length is written first so that
+// adjacent byte slices can't be confused with each other.
+func (w *walker) visitBytes(b []byte) (uint64, error) {
+	w.h.Reset()
+	if err := binary.Write(w.h, w.order, uint64(len(b))); err != nil {
+		return 0, err
+	}
+
+	_, err := w.h.Write(b)
+	return w.h.Sum64(), err
+}
+
+// arrayMarker is hashed along with the length of arrays when ArrayLengths
+// is set, so that they differ from slices with the same elements.
+var arrayMarker = []byte("hashstructure: array")
+
+// byteArrayMarker is hashed before the contents of byte arrays so that
+// they differ from byte slices and RawBytes with the same contents.
+var byteArrayMarker = []byte("hashstructure: byte array")
+
+// visitByteArray hashes the byte array v by writing its contents directly,
+// rather than hashing each element.
+func (w *walker) visitByteArray(v reflect.Value) (uint64, error) {
+	var b []byte
+	if v.CanAddr() {
+		b = v.Slice(0, v.Len()).Bytes()
+	} else {
+		b = make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+	}
+
+	w.h.Reset()
+	if _, err := w.h.Write(byteArrayMarker); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(w.h, w.order, uint64(len(b))); err != nil {
+		return 0, err
+	}
+
+	_, err := w.h.Write(b)
+	return w.h.Sum64(), err
+}
+
+// visitNamed hashes the value v, converted from the defined type t to its
+// underlying type, together with the full name of t.
+func (w *walker) visitNamed(t reflect.Type, v reflect.Value, opts *visitOpts) (uint64, error) {
+	nh, err := w.visit(reflect.ValueOf(t.PkgPath()+"."+t.Name()), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	h, err := w.visit(v, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, nh, h), nil
+}
+
+// boolMarker is hashed along with booleans when DistinctBools is set.
+var boolMarker = []byte("hashstructure: bool")
+
+// visitBool hashes b when DistinctBools is set.
+func (w *walker) visitBool(b bool) (uint64, error) {
+	var tmp uint64
+	if b {
+		tmp = 1
+	}
+
+	w.h.Reset()
+	if _, err := w.h.Write(boolMarker); err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, w.h.Sum64(), tmp), nil
+}
+
+// nilMarker is hashed along with the type of nil interfaces when
+// TypedNilInterfaces is set, and in place of nil regexps and URLs.
+var nilMarker = []byte("hashstructure: nil")
+
+// funcMarker is hashed in place of func values with IgnoreFuncs.
+var funcMarker = []byte("hashstructure: func")
+
+// redactedMarker is hashed in place of the values of fields tagged with
+// "redact".
+var redactedMarker = []byte("hashstructure: redacted")
+
+// opaqueMarker is hashed in place of structs skipped by
+// IgnoreUnexportedStructs.
+var opaqueMarker = []byte("hashstructure: opaque")
+
+// visitMarker returns the hash of the marker m.
+func (w *walker) visitMarker(m []byte) (uint64, error) {
+	w.h.Reset()
+	_, err := w.h.Write(m)
+	return w.h.Sum64(), err
+}
+
+// visitHooks hashes v by the interfaces it implements that the options
+// ask to use, if any. It returns false if none of them apply. This is
+// called again for the values of interfaces, since the interface itself
+// never implements them.
+func (w *walker) visitHooks(v reflect.Value, opts *visitOpts) (uint64, bool, error) {
+	// Values with a dedicated hash form are hashed by it if requested
+	if w.hashMarshaler {
+		if hm, ok := hashMarshalerOf(v); ok {
+			b, err := hm.MarshalHash()
+			if err != nil {
+				return 0, true, err
 			}
 
-			if w.format != FormatV1 {
-				// Important: read the docs for hashFinishUnordered
-				h = hashFinishUnordered(w.h, h)
+			h, err := w.visitBytes(b)
+			return h, true, err
+		}
+	}
+
+	// Replace the value with its canonical form if it has one. The
+	// canonical value itself isn't canonicalized again since it may well
+	// be the same type.
+	if w.canonical && (opts == nil || opts.Flags&visitFlagCanonical == 0) {
+		if c, ok := canonicalizerOf(v); ok {
+			newOpts := &visitOpts{Flags: visitFlagCanonical}
+			if opts != nil {
+				*newOpts = *opts
+				newOpts.Flags |= visitFlagCanonical
 			}
+
+			h, err := w.visit(reflect.ValueOf(c.Canonical()), newOpts)
+			return h, true, err
 		}
+	}
 
-		return h, nil
+	// Values with a Go syntax representation are hashed by it if requested.
+	// Nothing is known about what GoString prints, so it may well be
+	// addresses.
+	if w.goStringer {
+		if gs, ok := goStringerOf(v); ok {
+			if w.deterministic {
+				return 0, true, w.nondeterministic("GoString")
+			}
 
-	case reflect.Slice:
-		// We have two behaviors here. If it isn't a set, then we just
-		// visit all the elements. If it is a set, then we do a deterministic
-		// hash code.
-		var h uint64
-		var set bool
-		if opts != nil {
-			set = (opts.Flags & visitFlagSet) != 0
+			h, err := w.visit(reflect.ValueOf(gs.GoString()), nil)
+			return h, true, err
 		}
-		l := v.Len()
-		for i := 0; i < l; i++ {
-			current, err := w.visit(v.Index(i), nil)
+	}
+
+	// Values with their own encoding are hashed by it if requested
+	if w.gobEncoder {
+		if ge, ok := gobEncoderOf(v); ok {
+			b, err := ge.GobEncode()
 			if err != nil {
-				return 0, err
+				return 0, true, err
 			}
 
-			if set || w.sets {
-				h = hashUpdateUnordered(h, current)
+			h, err := w.visitBytes(b)
+			return h, true, err
+		}
+	}
+
+	// Values stored in a database are hashed by their stored form if
+	// requested. Like canonical values, that form isn't replaced again.
+	if w.valuer && (opts == nil || opts.Flags&visitFlagValuer == 0) {
+		if dv, ok := valuerOf(v); ok {
+			val, err := dv.Value()
+			if err != nil {
+				return 0, true, err
+			}
+
+			// NULL must not hash the same as a zero value
+			var h uint64
+			if val == nil {
+				h, err = w.visitMarker(nilMarker)
 			} else {
-				h = hashUpdateOrdered(w.h, h, current)
+				h, err = w.visit(reflect.ValueOf(val), &visitOpts{Flags: visitFlagValuer})
 			}
+			return h, true, err
 		}
+	}
 
-		if set && w.format != FormatV1 {
-			// Important: read the docs for hashFinishUnordered
-			h = hashFinishUnordered(w.h, h)
-		}
+	return 0, false, nil
+}
 
-		return h, nil
+// visitNilInterface hashes a nil value of the interface type t.
+func (w *walker) visitNilInterface(t reflect.Type) (uint64, error) {
+	th, err := w.visit(reflect.ValueOf(qualifiedName(t)), nil)
+	if err != nil {
+		return 0, err
+	}
 
-	case reflect.String:
-		// Directly hash
-		w.h.Reset()
-		_, err := w.h.Write([]byte(v.String()))
-		return w.h.Sum64(), err
+	nh, err := w.visitMarker(nilMarker)
+	if err != nil {
+		return 0, err
+	}
 
-	default:
-		return 0, fmt.Errorf("unknown kind to hash: %s", k)
+	return hashUpdateOrdered(w.h, w.order, th, nh), nil
+}
+
+// visitShared hashes the target of a pointer that is referenced n times
+// within the value being hashed.
+func (w *walker) visitShared(v reflect.Value, n int, opts *visitOpts) (uint64, error) {
+	h, err := w.visit(v, opts)
+	if err != nil {
+		return 0, err
 	}
 
+	return hashUpdateOrdered(w.h, w.order, uint64(n), h), nil
 }
 
-func hashUpdateOrdered(h hash.Hash64, a, b uint64) uint64 {
+func hashUpdateOrdered(h hash.Hash64, order binary.ByteOrder, a, b uint64) uint64 {
 	// For ordered updates, use a real hash function
 	h.Reset()
 
 	// We just panic if the binary writes fail because we are writing
 	// an int64 which should never be fail-able.
-	e1 := binary.Write(h, binary.LittleEndian, a)
-	e2 := binary.Write(h, binary.LittleEndian, b)
+	e1 := binary.Write(h, order, a)
+	e2 := binary.Write(h, order, b)
 	if e1 != nil {
 		panic(e1)
 	}
@@ -453,19 +2898,19 @@ func hashUpdateUnordered(a, b uint64) uint64 {
 // hashUpdateUnordered can effectively cancel out a previous change to the hash
 // result if the same hash value appears later on. For example, consider:
 //
-//   hashUpdateUnordered(hashUpdateUnordered("A", "B"), hashUpdateUnordered("A", "C")) =
-//   H("A") ^ H("B")) ^ (H("A") ^ H("C")) =
-//   (H("A") ^ H("A")) ^ (H("B") ^ H(C)) =
-//   H(B) ^ H(C) =
-//   hashUpdateUnordered(hashUpdateUnordered("Z", "B"), hashUpdateUnordered("Z", "C"))
+//	hashUpdateUnordered(hashUpdateUnordered("A", "B"), hashUpdateUnordered("A", "C")) =
+//	H("A") ^ H("B")) ^ (H("A") ^ H("C")) =
+//	(H("A") ^ H("A")) ^ (H("B") ^ H(C)) =
+//	H(B) ^ H(C) =
+//	hashUpdateUnordered(hashUpdateUnordered("Z", "B"), hashUpdateUnordered("Z", "C"))
 //
 // hashFinishUnordered "hardens" the result, so that encountering partially
 // overlapping input data later on in a different context won't cancel out.
-func hashFinishUnordered(h hash.Hash64, a uint64) uint64 {
+func hashFinishUnordered(h hash.Hash64, order binary.ByteOrder, a uint64) uint64 {
 	h.Reset()
 
 	// We just panic if the writes fail
-	e1 := binary.Write(h, binary.LittleEndian, a)
+	e1 := binary.Write(h, order, a)
 	if e1 != nil {
 		panic(e1)
 	}
@@ -473,10 +2918,189 @@ func hashFinishUnordered(h hash.Hash64, a uint64) uint64 {
 	return h.Sum64()
 }
 
+// countingHasher wraps a hash.Hash64 to count the bytes written to it. If
+// max is greater than zero, writes that would take the count past max are
+// counted but dropped. The dropped writes still succeed, since the hash
+// helpers can't return errors, so the walker checks tooLarge instead.
+type countingHasher struct {
+	hash.Hash64
+	n   int
+	max int
+}
+
+func (h *countingHasher) Write(p []byte) (int, error) {
+	if h.max > 0 && h.n+len(p) > h.max {
+		h.n += len(p)
+		return len(p), nil
+	}
+
+	n, err := h.Hash64.Write(p)
+	h.n += n
+	return n, err
+}
+
+// tooLarge returns true if more than max bytes have been written.
+func (h *countingHasher) tooLarge() bool {
+	return h.max > 0 && h.n > h.max
+}
+
+// mapEntryHash is the hash of a single key/value pair in a map.
+type mapEntryHash struct {
+	Key, Value uint64
+}
+
+// hashOrderedEntries hashes map entries as an ordered sequence sorted by
+// key hash, so the result doesn't depend on map iteration order.
+func hashOrderedEntries(h hash.Hash64, order binary.ByteOrder, entries []mapEntryHash) uint64 {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+
+		return entries[i].Value < entries[j].Value
+	})
+
+	h.Reset()
+
+	// We just panic if the binary writes fail because we are writing
+	// uint64s which should never be fail-able.
+	for _, e := range entries {
+		if err := binary.Write(h, order, e.Key); err != nil {
+			panic(err)
+		}
+		if err := binary.Write(h, order, e.Value); err != nil {
+			panic(err)
+		}
+	}
+
+	return h.Sum64()
+}
+
+// hashSorted hashes a sequence of hashes after sorting them, so the
+// result doesn't depend on their order but does depend on how many times
+// each appears.
+func hashSorted(h hash.Hash64, order binary.ByteOrder, hs []uint64) uint64 {
+	sort.Slice(hs, func(i, j int) bool { return hs[i] < hs[j] })
+
+	h.Reset()
+
+	// We just panic if the binary writes fail because we are writing
+	// uint64s which should never be fail-able.
+	for _, v := range hs {
+		if err := binary.Write(h, order, v); err != nil {
+			panic(err)
+		}
+	}
+
+	return h.Sum64()
+}
+
+// leastRotation returns the index that the lexicographically least
+// rotation of hs starts at, using Booth's algorithm. If there are several,
+// the smallest index is returned.
+func leastRotation(hs []uint64) int {
+	n := len(hs)
+	if n == 0 {
+		return 0
+	}
+
+	f := make([]int, 2*n)
+	for i := range f {
+		f[i] = -1
+	}
+
+	k := 0
+	for j := 1; j < 2*n; j++ {
+		sj := hs[j%n]
+		i := f[j-k-1]
+		for i != -1 && sj != hs[(k+i+1)%n] {
+			if sj < hs[(k+i+1)%n] {
+				k = j - i - 1
+			}
+			i = f[i]
+		}
+
+		if sj != hs[(k+i+1)%n] {
+			// i is -1 here
+			if sj < hs[k%n] {
+				k = j
+			}
+			f[j-k] = -1
+		} else {
+			f[j-k] = i + 1
+		}
+	}
+
+	return k % n
+}
+
+// numberMarker is hashed along with the text of numbers with
+// NumericAsString, so they differ from strings.
+var numberMarker = []byte("hashstructure: number")
+
+// visitNumericString hashes s, the decimal text of a number. The text is
+// hashed as a number so that it differs from strings, unless
+// NumbersMatchStrings is set and ScalarCategories isn't, in which case
+// it is the hash of the string s.
+func (w *walker) visitNumericString(s string) (uint64, error) {
+	if w.scalarCategories {
+		w.h.Reset()
+		if _, err := w.h.Write([]byte{'n'}); err != nil {
+			return 0, err
+		}
+
+		_, err := w.h.Write([]byte(s))
+		return w.h.Sum64(), err
+	}
+
+	sh, err := w.hashString(s)
+	if err != nil || w.numbersAsStrings {
+		return sh, err
+	}
+
+	mh, err := w.visitMarker(numberMarker)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, mh, sh), nil
+}
+
+// writeCategory writes a byte identifying the category of the scalar kind
+// k to the hash, if ScalarCategories is set.
+func (w *walker) writeCategory(k reflect.Kind) error {
+	if !w.scalarCategories {
+		return nil
+	}
+
+	var c byte
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c = 'i'
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c = 'u'
+	case reflect.Float32, reflect.Float64:
+		c = 'f'
+	case reflect.Complex64, reflect.Complex128:
+		c = 'c'
+	case reflect.String:
+		c = 's'
+	}
+
+	_, err := w.h.Write([]byte{c})
+	return err
+}
+
 // visitFlag is used as a bitmask for affecting visit behavior
 type visitFlag uint
 
 const (
 	visitFlagInvalid visitFlag = iota
-	visitFlagSet               = iota << 1
+	visitFlagSet     visitFlag = 1 << iota
+	visitFlagCanonical
+	visitFlagMultiset
+	visitFlagTransformed
+	visitFlagRotation
+	visitFlagValuer
+	visitFlagDedup
 )
@@ -2,6 +2,10 @@ package hashstructure
 
 import (
 	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
 )
 
 func ExampleHash() {
@@ -57,3 +61,220 @@ func ExampleHash_v1() {
 	// Output:
 	// 6691276962590150517
 }
+
+func ExampleNewMaphashHasher() {
+	opts := &HashOptions{Hasher: NewMaphashHasher()}
+
+	one, err := Hash("untrusted input", FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	two, err := Hash("untrusted input", FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(one == two)
+	// Output:
+	// true
+}
+
+func ExampleHashOptions_logger() {
+	type Person struct {
+		Name string
+		Age  uint8
+	}
+
+	opts := &HashOptions{
+		Logger: func(path string, kind reflect.Kind, n int) {
+			fmt.Printf("%q %s %d\n", path, kind, n)
+		},
+	}
+
+	if _, err := Hash(Person{Name: "foo", Age: 42}, FormatV2, opts); err != nil {
+		panic(err)
+	}
+	// Output:
+	// "" string 6
+	// "" string 4
+	// "Name" string 3
+	// "" string 3
+	// "Age" uint8 1
+	// "" struct 65
+}
+
+// exampleDecimal is shaped like shopspring/decimal.Decimal, which stores an
+// arbitrary precision coefficient and an exponent in unexported fields.
+type exampleDecimal struct {
+	value *big.Int
+	exp   int32
+}
+
+func (d exampleDecimal) Rat() *big.Rat {
+	r := new(big.Rat).SetInt(d.value)
+	e := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs32(d.exp))), nil)
+	if d.exp < 0 {
+		return r.Quo(r, new(big.Rat).SetInt(e))
+	}
+
+	return r.Mul(r, new(big.Rat).SetInt(e))
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+// Decimal types keep their state in unexported fields, so they must be
+// hashed through a hook. A Marshaler that hashes the reduced fraction makes
+// 1.50 and 1.5 hash the same without depending on the decimal package.
+func ExampleHashOptions_decimal() {
+	type Price struct {
+		Amount exampleDecimal
+	}
+
+	opts := &HashOptions{
+		Marshaler: func(v interface{}) ([]byte, bool, error) {
+			if d, ok := v.(exampleDecimal); ok {
+				return []byte(d.Rat().String()), true, nil
+			}
+
+			return nil, false, nil
+		},
+	}
+
+	// 1.50 and 1.5
+	one, err := Hash(Price{exampleDecimal{big.NewInt(150), -2}}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	two, err := Hash(Price{exampleDecimal{big.NewInt(15), -1}}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	// 1.6
+	three, err := Hash(Price{exampleDecimal{big.NewInt(16), -1}}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(one == two, one == three)
+	// Output:
+	// true false
+}
+
+func ExampleHashOptions_prune() {
+	type Container struct {
+		Name  string
+		Image string
+	}
+	type Object struct {
+		Name string
+		Spec struct {
+			Containers []Container
+		}
+		Status struct {
+			Phase      string
+			Conditions []string
+		}
+	}
+
+	// Only the desired state matters, so skip the whole Status subtree
+	opts := &HashOptions{
+		Prune: func(path string) bool {
+			return path == "Status"
+		},
+	}
+
+	var one, two Object
+	one.Name = "web"
+	one.Spec.Containers = []Container{{Name: "web", Image: "nginx"}}
+	two = one
+	two.Status.Phase = "Running"
+	two.Status.Conditions = []string{"Ready"}
+
+	h1, err := Hash(one, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	h2, err := Hash(two, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(h1 == h2)
+	// Output:
+	// true
+}
+
+// exampleSession caches the token it derives from its ID, which must not
+// affect its hash.
+type exampleSession struct {
+	ID    string
+	Token string
+}
+
+func (s exampleSession) MarshalHash() ([]byte, error) {
+	return []byte(s.ID), nil
+}
+
+func ExampleHashMarshaler() {
+	opts := &HashOptions{UseHashMarshaler: true}
+
+	one, err := Hash(exampleSession{ID: "abc"}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	two, err := Hash(exampleSession{ID: "abc", Token: "t0k3n"}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(one == two)
+	// Output:
+	// true
+}
+
+func ExampleHashOptions_ignoreInterfaces() {
+	type Source struct {
+		Path string
+		Body io.Reader
+	}
+	type Config struct {
+		Name    string
+		Sources []Source
+	}
+
+	// Readers are plumbing, so they don't change the identity of a config
+	opts := &HashOptions{
+		IgnoreInterfaces: []reflect.Type{reflect.TypeOf((*io.Reader)(nil)).Elem()},
+	}
+
+	one, err := Hash(Config{
+		Name:    "app",
+		Sources: []Source{{Path: "a.yaml", Body: strings.NewReader("a: 1")}},
+	}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	two, err := Hash(Config{
+		Name:    "app",
+		Sources: []Source{{Path: "a.yaml"}},
+	}, FormatV2, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(one == two)
+	// Output:
+	// true
+}
@@ -1,8 +1,30 @@
 package hashstructure
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -423,32 +445,58 @@ func TestHash_equalNil(t *testing.T) {
 func TestHash_equalSet(t *testing.T) {
 	type Test struct {
 		Name    string
-		Friends []string `hash:"set"`
+		Friends []string            `hash:"set"`
+		Labels  map[string][]string `hash:"set"`
 	}
 
 	cases := []struct {
 		One, Two interface{}
+		Format   Format
 		Match    bool
 	}{
 		{
 			Test{Name: "foo", Friends: []string{"foo", "bar"}},
 			Test{Name: "foo", Friends: []string{"bar", "foo"}},
+			testFormat,
 			true,
 		},
 
 		{
 			Test{Name: "foo", Friends: []string{"foo", "bar"}},
 			Test{Name: "foo", Friends: []string{"foo", "bar"}},
+			testFormat,
+			true,
+		},
+
+		{
+			Test{Name: "foo", Labels: map[string][]string{"a": {"foo", "bar"}}},
+			Test{Name: "foo", Labels: map[string][]string{"a": {"bar", "foo"}}},
+			FormatV2,
 			true,
 		},
+
+		// FormatV1 doesn't make the values of set maps sets
+		{
+			Test{Name: "foo", Labels: map[string][]string{"a": {"foo", "bar"}}},
+			Test{Name: "foo", Labels: map[string][]string{"a": {"bar", "foo"}}},
+			FormatV1,
+			false,
+		},
+
+		{
+			Test{Name: "foo", Labels: map[string][]string{"a": {"foo", "bar"}}},
+			Test{Name: "foo", Labels: map[string][]string{"b": {"bar", "foo"}}},
+			FormatV2,
+			false,
+		},
 	}
 
 	for _, tc := range cases {
-		one, err := Hash(tc.One, testFormat, nil)
+		one, err := Hash(tc.One, tc.Format, nil)
 		if err != nil {
 			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
 		}
-		two, err := Hash(tc.Two, testFormat, nil)
+		two, err := Hash(tc.Two, tc.Format, nil)
 		if err != nil {
 			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
 		}
@@ -555,6 +603,135 @@ func TestHash_ignoreZeroValue(t *testing.T) {
 	}
 }
 
+func TestHash_ignoreZeroValueKinds(t *testing.T) {
+	type Inner struct {
+		A int
+	}
+
+	base := struct{ Name string }{"a"}
+	opts := &HashOptions{IgnoreZeroValue: true}
+	cases := []struct {
+		Two   interface{}
+		Match bool
+	}{
+		{struct {
+			Name string
+			X    int
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    int
+		}{Name: "a", X: 1}, false},
+		{struct {
+			Name string
+			X    float64
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    bool
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    string
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    *int
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    *int
+		}{Name: "a", X: new(int)}, false},
+		{struct {
+			Name string
+			X    []int
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    map[string]int
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    interface{}
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    Inner
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    Inner
+		}{Name: "a", X: Inner{A: 1}}, false},
+		{struct {
+			Name string
+			X    [2]int
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    time.Time
+		}{Name: "a"}, true},
+		{struct {
+			Name string
+			X    func()
+		}{Name: "a"}, true},
+
+		// Empty but non-nil collections aren't zero values
+		{struct {
+			Name string
+			X    []int
+		}{Name: "a", X: []int{}}, false},
+		{struct {
+			Name string
+			X    map[string]int
+		}{Name: "a", X: map[string]int{}}, false},
+
+		// The option applies to every struct, however deeply nested
+		{struct {
+			Name  string
+			Inner struct{ X int }
+		}{Name: "a"}, true},
+	}
+
+	expected, err := Hash(base, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for i, tc := range cases {
+		actual, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		if (actual == expected) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v", i, tc.Match, tc.Two)
+		}
+	}
+
+	// Zero fields within nested structs are skipped too
+	var one struct {
+		Name  string
+		Inner struct{ A, B int }
+	}
+	var two struct {
+		Name  string
+		Inner struct{ A int }
+	}
+	one.Name, one.Inner.A = "a", 1
+	two.Name, two.Inner.A = "a", 1
+	h1, err := Hash(one, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	h2, err := Hash(two, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h1 != h2 {
+		t.Fatal("zero field of nested struct wasn't skipped")
+	}
+}
+
 func TestHash_includableMap(t *testing.T) {
 	cases := []struct {
 		One, Two interface{}
@@ -601,6 +778,151 @@ func TestHash_includableMap(t *testing.T) {
 	}
 }
 
+func TestHash_ignoreKeysTag(t *testing.T) {
+	type Labels map[string]string
+	type Resource struct {
+		Map    map[string]string            `hash:"ignorekeys=ignore,timestamp"`
+		Ptr    *Labels                      `hash:"ignorekeys=ignore"`
+		Nested map[string]map[string]string `hash:"ignorekeys=ignore"`
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			Resource{Map: map[string]string{"foo": "bar"}},
+			Resource{Map: map[string]string{"foo": "bar"}},
+			true,
+		},
+
+		{
+			Resource{Map: map[string]string{"foo": "bar", "ignore": "true"}},
+			Resource{Map: map[string]string{"foo": "bar"}},
+			true,
+		},
+
+		{
+			Resource{Map: map[string]string{"foo": "bar", "ignore": "true", "timestamp": "1"}},
+			Resource{Map: map[string]string{"foo": "bar", "timestamp": "2"}},
+			true,
+		},
+
+		{
+			Resource{Map: map[string]string{"foo": "bar", "ignore": "true"}},
+			Resource{Map: map[string]string{"bar": "baz"}},
+			false,
+		},
+
+		{
+			Resource{Ptr: &Labels{"foo": "bar", "ignore": "true"}},
+			Resource{Ptr: &Labels{"foo": "bar"}},
+			true,
+		},
+
+		// Only the keys of the tagged map itself are skipped
+		{
+			Resource{Nested: map[string]map[string]string{"a": {"ignore": "true"}}},
+			Resource{Nested: map[string]map[string]string{"a": {}}},
+			false,
+		},
+		{
+			Resource{Nested: map[string]map[string]string{"a": {}, "ignore": {}}},
+			Resource{Nested: map[string]map[string]string{"a": {}}},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Zero is always wrong
+		if one == 0 {
+			t.Fatalf("zero hash: %#v", tc.One)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Skipped keys are reported
+	var ignored []string
+	opts := &HashOptions{OnIgnore: func(path, reason string) {
+		ignored = append(ignored, path+" "+reason)
+	}}
+	v := Resource{Map: map[string]string{"foo": "bar", "ignore": "true"}}
+	if _, err := Hash(v, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ignored, []string{"Map[ignore] tag"}) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+
+	type Bad struct {
+		Map map[int]string `hash:"ignorekeys=1"`
+	}
+	if _, err := Hash(Bad{}, testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	} else if _, ok := err.(*ErrInvalidTag); !ok {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestHash_transformableMap(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			testTransformableMap{Map: map[string]string{"Foo": "bar"}},
+			testTransformableMap{Map: map[string]string{"foo": "bar"}},
+			true,
+		},
+
+		{
+			testTransformableMap{Map: map[string]string{"foo": "bar", "ignore": "true"}},
+			testTransformableMap{Map: map[string]string{"FOO": "bar"}},
+			true,
+		},
+
+		{
+			testTransformableMap{Map: map[string]string{"foo": "bar"}},
+			testTransformableMap{Map: map[string]string{"foo": "baz"}},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Zero is always wrong
+		if one == 0 {
+			t.Fatalf("zero hash: %#v", tc.One)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
 func TestHash_hashable(t *testing.T) {
 	cases := []struct {
 		One, Two interface{}
@@ -701,6 +1023,101 @@ func (t testIncludableMap) HashIncludeMap(field string, k, v interface{}) (bool,
 	return true, nil
 }
 
+type testTransformableMap struct {
+	Map map[string]string
+}
+
+func (t testTransformableMap) HashMapEntry(field string, k, v interface{}) (interface{}, interface{}, bool, error) {
+	s := k.(string)
+	if s == "ignore" {
+		return nil, nil, false, nil
+	}
+
+	return strings.ToLower(s), v, true, nil
+}
+
+// testSet is an insertion ordered set that hashes via Ranger.
+type testSet struct {
+	items []string
+}
+
+func newTestSet(items ...string) *testSet {
+	return &testSet{items: items}
+}
+
+func (s *testSet) Range(f func(k, v interface{}) bool) {
+	for _, item := range s.items {
+		if !f(item, struct{}{}) {
+			return
+		}
+	}
+}
+
+// testMapSet is shaped like a generic Set[T comparable] backed by a
+// map[T]struct{}, which hashes via Ranger.
+type testMapSet struct {
+	m map[interface{}]struct{}
+}
+
+func newTestMapSet(items ...interface{}) *testMapSet {
+	s := &testMapSet{m: make(map[interface{}]struct{})}
+	for _, item := range items {
+		s.m[item] = struct{}{}
+	}
+
+	return s
+}
+
+func (s *testMapSet) Range(f func(k, v interface{}) bool) {
+	for k, v := range s.m {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// testOrderedMap is an insertion ordered map that hashes via OrderedRanger.
+// It also implements Ranger, which must not be used.
+type testOrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newTestOrderedMap(kvs ...interface{}) *testOrderedMap {
+	m := &testOrderedMap{values: make(map[string]interface{})}
+	for i := 0; i < len(kvs); i += 2 {
+		k := kvs[i].(string)
+		m.keys = append(m.keys, k)
+		m.values[k] = kvs[i+1]
+	}
+
+	return m
+}
+
+func (m *testOrderedMap) RangeOrdered(f func(k, v interface{}) bool) {
+	for _, k := range m.keys {
+		if !f(k, m.values[k]) {
+			return
+		}
+	}
+}
+
+func (m *testOrderedMap) Range(f func(k, v interface{}) bool) {
+	panic("Range called on an OrderedRanger")
+}
+
+// testCanonical canonicalizes by sorting its tags. The canonical value is
+// the same type, which must not be canonicalized again.
+type testCanonical struct {
+	Tags []string
+}
+
+func (t testCanonical) Canonical() interface{} {
+	tags := append([]string(nil), t.Tags...)
+	sort.Strings(tags)
+	return testCanonical{Tags: tags}
+}
+
 type testHashable struct {
 	Value string
 	Err   error
@@ -729,3 +1146,6142 @@ func (t *testHashablePointer) Hash() (uint64, error) {
 
 	return 100, nil
 }
+
+func TestHash_canonicalNumbers(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{int8(5), int(5), true},
+		{int32(5), uint64(5), true},
+		{uint8(5), int64(5), true},
+		{float32(0.5), float64(0.5), true},
+		{int(5), int(6), false},
+		{
+			struct{ Foo int16 }{Foo: 42},
+			struct{ Foo uint }{Foo: 42},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, &HashOptions{CanonicalNumbers: true})
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, &HashOptions{CanonicalNumbers: true})
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Without the option the types still matter
+	one, err := Hash(int8(5), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(int(5), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("expected different hashes without CanonicalNumbers")
+	}
+}
+
+func TestHash_sharePointers(t *testing.T) {
+	type Node struct {
+		Name string
+	}
+	type Graph struct {
+		A, B *Node
+	}
+
+	shared := &Node{Name: "foo"}
+	sharedGraph := Graph{A: shared, B: shared}
+	distinctGraph := Graph{A: &Node{Name: "foo"}, B: &Node{Name: "foo"}}
+
+	opts := &HashOptions{SharePointers: true}
+	one, err := Hash(sharedGraph, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(distinctGraph, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("shared and distinct pointers should hash differently")
+	}
+
+	// Without sharing, the option must not change the hash
+	three, err := Hash(distinctGraph, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if two != three {
+		t.Fatal("SharePointers changed the hash of a value with no sharing")
+	}
+
+	// Pointers that only share an address aren't shared: a struct and its
+	// first field, and distinct zero-size values
+	type Empty struct{}
+	first := &Node{Name: "foo"}
+	for i, v := range []interface{}{
+		struct {
+			N    *Node
+			Name *string
+		}{first, &first.Name},
+		struct{ A, B *Empty }{new(Empty), new(Empty)},
+		[]*[0]int{new([0]int), new([0]int)},
+	} {
+		one, err := Hash(v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		two, err := Hash(v, testFormat, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if one != two {
+			t.Fatalf("%d: SharePointers changed the hash of a value with no sharing", i)
+		}
+	}
+
+	// Only references that are hashed count, so a pointer that is also
+	// in an excluded field isn't shared
+	other := &Node{Name: "foo"}
+	prune := &HashOptions{SharePointers: true, Prune: func(path string) bool { return path == "B" }}
+	unexported := &HashOptions{SharePointers: true, IncludeUnexported: true}
+	excluded := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			struct{ A, B *Node }{shared, shared},
+			struct{ A, B *Node }{shared, other},
+			opts,
+			false,
+		},
+		{
+			struct {
+				A *Node
+				B *Node `hash:"redact"`
+			}{shared, shared},
+			struct {
+				A *Node
+				B *Node `hash:"redact"`
+			}{shared, other},
+			opts,
+			true,
+		},
+		{
+			struct{ A, B *Node }{shared, shared},
+			struct{ A, B *Node }{shared, other},
+			prune,
+			true,
+		},
+		{
+			struct {
+				A *Node
+				b *Node
+			}{shared, shared},
+			struct {
+				A *Node
+				b *Node
+			}{shared, other},
+			opts,
+			true,
+		},
+		{
+			struct {
+				A *Node
+				b *Node
+			}{shared, shared},
+			struct {
+				A *Node
+				b *Node
+			}{shared, other},
+			unexported,
+			false,
+		},
+	}
+	for i, tc := range excluded {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v", i, tc.Match)
+		}
+	}
+
+	// Sharing inside maps must be deterministic
+	m := map[string]*Node{"a": shared, "b": shared, "c": &Node{Name: "bar"}}
+	want, err := Hash(m, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		got, err := Hash(m, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if got != want {
+			t.Fatalf("non-deterministic hash: %d != %d", got, want)
+		}
+	}
+}
+
+func TestNewMaphashHasher(t *testing.T) {
+	v := map[string]interface{}{"foo": []string{"bar", "baz"}}
+
+	// The same hasher must be deterministic
+	h := NewMaphashHasher()
+	one, err := Hash(v, testFormat, &HashOptions{Hasher: h})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(v, testFormat, &HashOptions{Hasher: h})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatalf("non-matching: %d, %d", one, two)
+	}
+
+	// A new hasher, like one in another process, has a new seed
+	three, err := Hash(v, testFormat, &HashOptions{Hasher: NewMaphashHasher()})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == three {
+		t.Fatal("expected different seeds to produce different hashes")
+	}
+}
+
+func TestAssertConsistent(t *testing.T) {
+	type Test struct {
+		Name    string
+		Friends []string `hash:"set"`
+		Meta    map[string]interface{}
+	}
+
+	v := Test{
+		Name:    "foo",
+		Friends: []string{"a", "b", "c", "d"},
+		Meta:    map[string]interface{}{"foo": []int{1, 2}, "bar": nil},
+	}
+
+	if err := AssertConsistent(testFormat, nil, v, &v, nil, "foo", 42); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	opts := &HashOptions{SlicesAsSets: true}
+	if err := AssertConsistent(testFormat, opts, []string{"a", "b", "c"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Slices that aren't sets are left in order
+	if err := AssertConsistent(testFormat, nil, []string{"a", "b", "c"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A hasher that never resets violates determinism
+	err := AssertConsistent(testFormat, &HashOptions{Hasher: &testNoResetHasher{}}, v)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCheckDistinct(t *testing.T) {
+	type Test struct {
+		Name   string
+		secret string
+		Tags   []string `hash:"ignore"`
+	}
+
+	vs := []interface{}{
+		Test{Name: "foo", secret: "a"},
+		Test{Name: "bar"},
+		Test{Name: "foo", secret: "b", Tags: []string{"x"}},
+		"foo",
+	}
+
+	var calls int
+	opts := &HashOptions{OnIgnore: func(string, string) { calls++ }}
+	pairs, err := CheckDistinct(vs, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if calls == 0 {
+		t.Fatal("expected OnIgnore to still be called")
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("bad: %#v", pairs)
+	}
+
+	p := pairs[0]
+	if p.I != 0 || p.J != 2 {
+		t.Fatalf("bad: %#v", p)
+	}
+	expected := []string{"Tags (tag)", "secret (unexported)"}
+	if !reflect.DeepEqual(p.Ignored, expected) {
+		t.Fatalf("bad: %#v", p.Ignored)
+	}
+	if !strings.Contains(p.String(), "secret (unexported)") {
+		t.Fatalf("bad: %s", p)
+	}
+
+	// Distinct values don't collide
+	pairs, err = CheckDistinct([]interface{}{1, 2, "1", []int{1}}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(pairs) != 0 {
+		t.Fatalf("bad: %#v", pairs)
+	}
+
+	// Errors are returned
+	if _, err := CheckDistinct([]interface{}{func() {}}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// testNoResetHasher is a broken hasher that keeps state across hashes.
+type testNoResetHasher struct {
+	sum uint64
+}
+
+func (h *testNoResetHasher) Write(p []byte) (int, error) {
+	for _, b := range p {
+		h.sum = h.sum*31 + uint64(b)
+	}
+	return len(p), nil
+}
+
+func (h *testNoResetHasher) Sum(b []byte) []byte { return b }
+func (h *testNoResetHasher) Reset()              {}
+func (h *testNoResetHasher) Size() int           { return 8 }
+func (h *testNoResetHasher) BlockSize() int      { return 1 }
+func (h *testNoResetHasher) Sum64() uint64       { return h.sum }
+
+func TestHash_ignoreSyncPrimitives(t *testing.T) {
+	type Locked struct {
+		sync.Mutex
+		Name string
+		Once *sync.Once
+	}
+
+	v := &Locked{Name: "foo", Once: &sync.Once{}}
+	before, err := Hash(v, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Lock state must never affect the hash
+	v.Lock()
+	v.Once.Do(func() {})
+	during, err := Hash(v, testFormat, nil)
+	v.Unlock()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if before != during {
+		t.Fatalf("lock state changed hash: %d != %d", before, during)
+	}
+
+	// With the option, the lock fields are skipped entirely
+	opts := &HashOptions{IgnoreSyncPrimitives: true}
+	one, err := Hash(struct {
+		sync.RWMutex
+		Name string
+		Wg   sync.WaitGroup
+	}{Name: "foo"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(struct{ Name string }{Name: "foo"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatalf("sync primitives were not ignored: %d != %d", one, two)
+	}
+}
+
+func TestHash_orderedMaps(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			map[string]string{"foo": "bar", "bar": "baz"},
+			map[string]string{"bar": "baz", "foo": "bar"},
+			true,
+		},
+
+		{
+			map[string]string{"foo": "bar", "bar": "baz"},
+			map[string]string{"foo": "baz", "bar": "bar"},
+			false,
+		},
+
+		{
+			map[string]interface{}{"foo": map[int]int{1: 2, 3: 4}},
+			map[interface{}]interface{}{"foo": map[int]int{3: 4, 1: 2}},
+			true,
+		},
+
+		{
+			map[string]string{},
+			map[string]string{"foo": "bar"},
+			false,
+		},
+	}
+
+	opts := &HashOptions{OrderedMaps: true}
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Ordering must still not depend on map iteration
+	m := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	if err := AssertConsistent(testFormat, opts, m); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestHash_defaultFormat(t *testing.T) {
+	defer func(f Format) { DefaultFormat = f }(DefaultFormat)
+
+	v := map[string]interface{}{"foo": []string{"bar"}}
+	for _, f := range []Format{FormatV1, FormatV2} {
+		DefaultFormat = f
+
+		expected, err := Hash(v, f, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		actual, err := Hash(v, 0, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != expected {
+			t.Fatalf("format %d: bad: %d != %d", f, actual, expected)
+		}
+	}
+
+	DefaultFormat = formatMax
+	if _, err := Hash(v, 0, nil); err == nil {
+		t.Fatal("expected error for invalid DefaultFormat")
+	}
+	if _, err := Hash(v, formatMax, nil); err == nil {
+		t.Fatal("expected error for invalid format")
+	}
+}
+
+func TestHash_namedTypeIdentity(t *testing.T) {
+	type Flags uint32
+	type OtherFlags uint32
+	type Status string
+	type Role string
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{os.FileMode(0644), int(0644), false},
+		{os.FileMode(0644), uint32(0644), false},
+		{os.FileMode(0644), Flags(0644), false},
+		{Flags(1), OtherFlags(1), false},
+		{Flags(1), Flags(1), true},
+		{Flags(1), Flags(2), false},
+		{uint32(7), uint32(7), true},
+		{Status("active"), Role("active"), false},
+		{Status("active"), "active", false},
+		{Status("active"), Status("active"), true},
+		{[]interface{}{Status("admin")}, []interface{}{Role("admin")}, false},
+		{
+			map[string]interface{}{"state": Status("admin")},
+			map[string]interface{}{"state": Role("admin")},
+			false,
+		},
+		{
+			struct{ Mode os.FileMode }{0755},
+			struct{ Mode uint32 }{0755},
+			false,
+		},
+	}
+
+	opts := &HashOptions{NamedTypeIdentity: true}
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_rawBytes(t *testing.T) {
+	type Message struct {
+		Name string
+		Wire RawBytes
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{RawBytes("foo"), RawBytes("foo"), true},
+		{RawBytes("foo"), RawBytes("bar"), false},
+		{RawBytes(nil), RawBytes{}, true},
+		{RawBytes("foo"), []byte("foo"), false},
+		{
+			[]RawBytes{RawBytes("ab"), RawBytes("c")},
+			[]RawBytes{RawBytes("a"), RawBytes("bc")},
+			false,
+		},
+		{
+			Message{Name: "foo", Wire: RawBytes{0x08, 0x96, 0x01}},
+			Message{Name: "foo", Wire: RawBytes{0x08, 0x96, 0x01}},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_mapKeyTypes(t *testing.T) {
+	type Key int32
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			map[interface{}]int{int32(1): 1},
+			map[interface{}]int{int64(1): 1},
+			nil,
+			false,
+		},
+		{
+			map[interface{}]int{int32(1): 1},
+			map[interface{}]int{int64(1): 1},
+			&HashOptions{CanonicalNumbers: true},
+			true,
+		},
+		{
+			map[interface{}]int{int32(1): 1},
+			map[interface{}]int{Key(1): 1},
+			&HashOptions{NamedTypeIdentity: true},
+			false,
+		},
+		{
+			map[interface{}]int{int32(1): 1},
+			map[interface{}]int{Key(1): 1},
+			&HashOptions{CanonicalNumbers: true},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_onIgnore(t *testing.T) {
+	type Inner struct {
+		Name   string
+		secret string
+		Skip   string `hash:"ignore"`
+	}
+	type Outer struct {
+		Inners []Inner
+		Zero   string
+		Map    testIncludableMap
+	}
+
+	v := Outer{
+		Inners: []Inner{{Name: "foo"}, {Name: "bar"}},
+		Map:    testIncludableMap{Map: map[string]string{"ignore": "true"}},
+	}
+
+	var ignored []string
+	opts := &HashOptions{
+		IgnoreZeroValue: true,
+		OnIgnore: func(path, reason string) {
+			ignored = append(ignored, path+" "+reason)
+		},
+	}
+	if _, err := Hash(v, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{
+		"Inners[0].secret unexported",
+		"Inners[0].Skip tag",
+		"Inners[1].secret unexported",
+		"Inners[1].Skip tag",
+		"Zero zero",
+		"Map.Map[ignore] include",
+	}
+	if !reflect.DeepEqual(ignored, expected) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+}
+
+func TestHash_location(t *testing.T) {
+	type Schedule struct {
+		Name     string
+		Location *time.Location
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			Schedule{Name: "foo", Location: time.FixedZone("EST", -5*60*60)},
+			Schedule{Name: "foo", Location: time.FixedZone("EST", -5*60*60)},
+			true,
+		},
+		{
+			Schedule{Name: "foo", Location: time.FixedZone("EST", -5*60*60)},
+			Schedule{Name: "foo", Location: time.FixedZone("PST", -8*60*60)},
+			false,
+		},
+		{
+			Schedule{Name: "foo", Location: nil},
+			Schedule{Name: "foo", Location: time.UTC},
+			true,
+		},
+		{
+			Schedule{Name: "foo", Location: time.UTC},
+			Schedule{Name: "foo", Location: time.FixedZone("EST", -5*60*60)},
+			false,
+		},
+		{
+			*time.FixedZone("EST", -5*60*60),
+			time.FixedZone("EST", -5*60*60),
+			true,
+		},
+		{
+			[]time.Location{*time.FixedZone("EST", -5*60*60)},
+			[]*time.Location{time.FixedZone("EST", -5*60*60)},
+			true,
+		},
+		{*time.UTC, RawBytes("UTC"), false},
+	}
+
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// FormatV1 never changes, so it still hashes the unexported state
+	one, err := Hash(time.FixedZone("EST", -5*60*60), FormatV1, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(time.FixedZone("PST", -8*60*60), FormatV1, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("FormatV1 hash changed")
+	}
+}
+
+func TestHash_includeTags(t *testing.T) {
+	one := struct {
+		Name string `json:"name"`
+	}{Name: "foo"}
+	two := struct {
+		Name string `json:"full_name"`
+	}{Name: "foo"}
+	three := struct {
+		Name string
+	}{Name: "foo"}
+
+	for _, tc := range []struct {
+		Opts  *HashOptions
+		Match bool
+	}{
+		{nil, true},
+		{&HashOptions{IncludeTags: true}, false},
+	} {
+		h1, err := Hash(one, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		h2, err := Hash(two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if (h1 == h2) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%d\n\n%d", tc.Match, h1, h2)
+		}
+	}
+
+	// Fields without tags are unaffected by the option
+	h1, err := Hash(three, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	h2, err := Hash(three, testFormat, &HashOptions{IncludeTags: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h1 != h2 {
+		t.Fatalf("bad: %d != %d", h1, h2)
+	}
+}
+
+func TestHash_funcsByPointer(t *testing.T) {
+	type Handlers struct {
+		Name    string
+		Handler func() string
+	}
+
+	foo := func() string { return "foo" }
+	bar := func() string { return "bar" }
+
+	// Without the option funcs can't be hashed
+	if _, err := Hash(Handlers{Handler: foo}, testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{Handlers{Handler: foo}, Handlers{Handler: foo}, true},
+		{Handlers{Handler: foo}, Handlers{Handler: bar}, false},
+		{Handlers{Handler: nil}, Handlers{Handler: foo}, false},
+		{Handlers{Handler: nil}, Handlers{Handler: nil}, true},
+	}
+
+	opts := &HashOptions{FuncsByPointer: true}
+	for _, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%#v\n\n%#v", tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_byteOrder(t *testing.T) {
+	v := map[string]interface{}{"foo": 42, "bar": []uint16{1, 2}}
+
+	def, err := Hash(v, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	little, err := Hash(v, testFormat, &HashOptions{ByteOrder: binary.LittleEndian})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	big, err := Hash(v, testFormat, &HashOptions{ByteOrder: binary.BigEndian})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if def != little {
+		t.Fatalf("default should be little endian: %d != %d", def, little)
+	}
+	if def == big {
+		t.Fatal("big endian should hash differently")
+	}
+}
+
+func TestHash_structMapKeys(t *testing.T) {
+	type Point struct {
+		X, Y  int
+		Label string `custom:"ignore"`
+	}
+
+	a, b := Point{X: 1, Y: 2}, Point{X: 3, Y: 4}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			map[Point]int{a: 1, b: 2},
+			map[Point]int{b: 2, a: 1},
+			nil,
+			true,
+		},
+		{
+			map[Point]int{a: 1, b: 2},
+			map[Point]int{a: 2, b: 1},
+			nil,
+			false,
+		},
+		{
+			map[Point]int{a: 1, b: 2},
+			map[Point]int{a: 2, b: 1},
+			&HashOptions{OrderedMaps: true},
+			false,
+		},
+		{
+			map[Point]int{{X: 1, Label: "foo"}: 1},
+			map[Point]int{{X: 1, Label: "bar"}: 1},
+			nil,
+			false,
+		},
+		{
+			map[Point]int{{X: 1, Label: "foo"}: 1},
+			map[Point]int{{X: 1, Label: "bar"}: 1},
+			&HashOptions{TagName: "custom"},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_canonicalJSON(t *testing.T) {
+	type Person struct {
+		Name string            `json:"name"`
+		Age  int               `json:"age"`
+		Tags map[string]string `json:"tags"`
+	}
+
+	v := Person{Name: "<foo>", Age: 42, Tags: map[string]string{"b": "2", "a": "1"}}
+	expected := `{"age":42,"name":"<foo>","tags":{"a":"1","b":"2"}}`
+
+	b, err := canonicalJSON(v)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(b) != expected {
+		t.Fatalf("bad: %s", b)
+	}
+
+	h := fnv.New64()
+	h.Write([]byte(expected))
+
+	actual, err := Hash(v, testFormat, &HashOptions{CanonicalJSON: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != h.Sum64() {
+		t.Fatalf("bad: %d != %d", actual, h.Sum64())
+	}
+
+	// A map with the same JSON encoding hashes the same
+	other, err := Hash(map[string]interface{}{
+		"tags": map[string]string{"a": "1", "b": "2"},
+		"name": "<foo>",
+		"age":  42,
+	}, testFormat, &HashOptions{CanonicalJSON: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if other != actual {
+		t.Fatalf("bad: %d != %d", other, actual)
+	}
+
+	// Unencodable values are an error
+	if _, err := Hash(func() {}, testFormat, &HashOptions{CanonicalJSON: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_cycle(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+
+	m := map[string]interface{}{"foo": "bar"}
+	m["self"] = m
+
+	s := []interface{}{"foo", nil}
+	s[1] = s
+
+	n := &Node{Name: "foo"}
+	n.Next = &Node{Name: "bar", Next: n}
+
+	for _, v := range []interface{}{m, s, n, []interface{}{m, m}} {
+		if err := AssertConsistent(testFormat, nil, v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := AssertConsistent(testFormat, &HashOptions{SharePointers: true}, v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The cycle must still be part of the hash
+	other := map[string]interface{}{"foo": "bar", "self": map[string]interface{}{}}
+	one, err := Hash(m, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(other, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("cyclic map should not hash like an empty map")
+	}
+}
+
+func TestHash_gostring(t *testing.T) {
+	type Inner struct {
+		A, B int
+	}
+	type Test struct {
+		Name  string
+		Inner *Inner `hash:"gostring"`
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			Test{Name: "foo", Inner: &Inner{A: 1}},
+			Test{Name: "foo", Inner: &Inner{A: 1}},
+			nil,
+			true,
+		},
+		{
+			Test{Name: "foo", Inner: &Inner{A: 1}},
+			Test{Name: "foo", Inner: &Inner{B: 1}},
+			nil,
+			false,
+		},
+		{
+			Test{Name: "foo", Inner: nil},
+			Test{Name: "foo", Inner: &Inner{}},
+			nil,
+			false,
+		},
+		{
+			map[string]int{"a": 1, "b": 2},
+			map[string]int{"b": 2, "a": 1},
+			&HashOptions{StringifyAll: true},
+			true,
+		},
+		{
+			[]int{1, 2},
+			[]int{2, 1},
+			&HashOptions{StringifyAll: true},
+			false,
+		},
+		{
+			struct{ Foo int8 }{Foo: 1},
+			struct{ Foo int64 }{Foo: 1},
+			&HashOptions{StringifyAll: true},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// The rendered text is what's hashed
+	one, err := Hash([]string{"foo"}, testFormat, &HashOptions{StringifyAll: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(`[]string{"foo"}`, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatalf("bad: %d != %d", one, two)
+	}
+}
+
+func TestHash_typedNilInterfaces(t *testing.T) {
+	type Hooks = struct {
+		Reader io.Reader
+		Err    error
+		Count  int
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			Hooks{},
+			struct {
+				Reader error
+				Err    error
+				Count  int
+			}{},
+			nil,
+			true,
+		},
+		{
+			Hooks{},
+			struct {
+				Reader error
+				Err    error
+				Count  int
+			}{},
+			&HashOptions{TypedNilInterfaces: true},
+			false,
+		},
+		{
+			struct{ Foo interface{} }{},
+			struct{ Foo int }{},
+			&HashOptions{TypedNilInterfaces: true},
+			false,
+		},
+		{
+			struct{ Foo interface{} }{Foo: 0},
+			struct{ Foo int }{},
+			&HashOptions{TypedNilInterfaces: true},
+			true,
+		},
+		{
+			Hooks{Reader: strings.NewReader("")},
+			Hooks{},
+			&HashOptions{TypedNilInterfaces: true},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHasherPool(t *testing.T) {
+	v := map[string]interface{}{"foo": []string{"bar", "baz"}}
+	expected, err := Hash(v, testFormat, &HashOptions{SlicesAsSets: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := &HasherPool{Format: testFormat, Options: HashOptions{SlicesAsSets: true}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h := p.Get()
+				actual, err := h.Hash(v)
+				p.Put(h)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if actual != expected {
+					errs <- fmt.Errorf("bad: %d != %d", actual, expected)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	v := map[string]interface{}{"foo": []string{"bar", "baz"}, "num": 42}
+	for i := 0; i < b.N; i++ {
+		if _, err := Hash(v, testFormat, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHasherPool(b *testing.B) {
+	v := map[string]interface{}{"foo": []string{"bar", "baz"}, "num": 42}
+	p := &HasherPool{Format: testFormat}
+	for i := 0; i < b.N; i++ {
+		h := p.Get()
+		if _, err := h.Hash(v); err != nil {
+			b.Fatal(err)
+		}
+		p.Put(h)
+	}
+}
+
+func TestHash_sortFields(t *testing.T) {
+	one := struct{ Lname, Fname string }{"bar", "foo"}
+	two := struct{ Fname, Lname string }{"foo", "bar"}
+
+	for _, tc := range []struct {
+		Opts  *HashOptions
+		Match bool
+	}{
+		{nil, false},
+		{&HashOptions{SortFields: true}, true},
+	} {
+		h1, err := Hash(one, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		h2, err := Hash(two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if (h1 == h2) != tc.Match {
+			t.Fatalf("bad, expected: %#v\n\n%d\n\n%d", tc.Match, h1, h2)
+		}
+	}
+}
+
+func TestHash_marshaler(t *testing.T) {
+	type Message struct {
+		Name      string
+		SizeCache int32
+	}
+	type Envelope struct {
+		ID      int
+		Message *Message
+	}
+
+	// The marshaler ignores SizeCache, like a wire encoding would
+	opts := &HashOptions{
+		Marshaler: func(v interface{}) ([]byte, bool, error) {
+			m, ok := v.(*Message)
+			if !ok {
+				return nil, false, nil
+			}
+			if m.Name == "error" {
+				return nil, false, fmt.Errorf("marshal error")
+			}
+
+			return []byte(m.Name), true, nil
+		},
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			Envelope{ID: 1, Message: &Message{Name: "foo", SizeCache: 1}},
+			Envelope{ID: 1, Message: &Message{Name: "foo", SizeCache: 2}},
+			true,
+		},
+		{
+			Envelope{ID: 1, Message: &Message{Name: "foo"}},
+			Envelope{ID: 1, Message: &Message{Name: "bar"}},
+			false,
+		},
+		{
+			[]interface{}{&Message{Name: "foo"}},
+			[]interface{}{RawBytes("foo")},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	if _, err := Hash(&Message{Name: "error"}, testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_ranger(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			newTestSet("foo", "bar"),
+			newTestSet("bar", "foo"),
+			true,
+		},
+		{
+			newTestSet("foo", "bar"),
+			newTestSet("foo"),
+			false,
+		},
+		{
+			newTestSet("foo", "bar"),
+			map[string]struct{}{"foo": {}, "bar": {}},
+			true,
+		},
+		{
+			struct{ Set *testSet }{newTestSet("foo")},
+			struct{ Set *testSet }{newTestSet("bar")},
+			false,
+		},
+
+		// Sets backed by maps, in different insertion orders
+		{
+			newTestMapSet(1, 2, 3, "a"),
+			newTestMapSet("a", 3, 2, 1),
+			true,
+		},
+		{
+			newTestMapSet(1, 2, 3),
+			newTestMapSet(1, 2),
+			false,
+		},
+		{
+			newTestMapSet(1, 2, 3),
+			newTestMapSet(1, 2, 3, 4),
+			false,
+		},
+		{
+			newTestMapSet(),
+			newTestMapSet(1),
+			false,
+		},
+		{
+			newTestMapSet(1, 2),
+			map[int]struct{}{1: {}, 2: {}},
+			true,
+		},
+		{
+			struct{ Tags *testMapSet }{newTestMapSet("x", "y")},
+			struct{ Tags *testMapSet }{newTestMapSet("y", "x")},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+	// Every subset of a set hashes differently
+	seen := make(map[uint64]int)
+	for mask := 0; mask < 1<<8; mask++ {
+		s := newTestMapSet()
+		for i := 0; i < 8; i++ {
+			if mask&(1<<i) != 0 {
+				s.m[i] = struct{}{}
+			}
+		}
+
+		h, err := Hash(s, testFormat, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if other, ok := seen[h]; ok {
+			t.Fatalf("subsets %b and %b hash the same", other, mask)
+		}
+		seen[h] = mask
+	}
+}
+
+func TestHash_inline(t *testing.T) {
+	type Address struct {
+		Street string
+		City   string
+	}
+
+	flat := struct {
+		Name   string
+		Street string
+		City   string
+	}{"foo", "Main", "Springfield"}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			flat,
+			struct {
+				Name    string
+				Address Address `hash:"inline"`
+			}{"foo", Address{"Main", "Springfield"}},
+			true,
+		},
+		{
+			flat,
+			struct {
+				Name    string
+				Address *Address `hash:"inline"`
+			}{"foo", &Address{"Main", "Springfield"}},
+			true,
+		},
+		{
+			flat,
+			struct {
+				Name    string
+				Address Address
+			}{"foo", Address{"Main", "Springfield"}},
+			false,
+		},
+		{
+			struct {
+				Name   string
+				Street string
+				City   string
+			}{},
+			struct {
+				Name    string
+				Address *Address `hash:"inline"`
+			}{},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	_, err := Hash(struct {
+		Name string `hash:"inline"`
+	}{"foo"}, testFormat, nil)
+	if _, ok := err.(*ErrNotStruct); !ok {
+		t.Fatalf("expected ErrNotStruct, got: %#v", err)
+	}
+}
+
+func TestHash_floatPrecision(t *testing.T) {
+	// Variables so that the sums aren't exact constant expressions
+	a, b := 0.1, 0.2
+	a32, b32 := float32(0.1), float32(0.2)
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{a + b, 0.3, true},
+		{[]float64{a + b, 1.0 / 3}, []float64{0.3, 0.3333333333}, true},
+		{0.3, 0.31, false},
+		{math.Copysign(0, -1), 0.0, true},
+		{-0.00000000001, 0.0, true},
+		{math.NaN(), math.Float64frombits(0x7ff8000000000002), true},
+		{a32 + b32, float32(0.3), true},
+		{math.MaxFloat64, math.MaxFloat64, true},
+	}
+
+	opts := &HashOptions{FloatPrecision: 6}
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Without the option floats are exact
+	one, err := Hash(a+b, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(0.3, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("expected exact float hashing by default")
+	}
+}
+
+func TestSchemaHash(t *testing.T) {
+	type Node struct {
+		Name     string `json:"name"`
+		Children []*Node
+	}
+	type Tree map[string]Tree
+	type List []List
+	type Func func(Func) Func
+	type Chan chan Chan
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			Node{Name: "foo"},
+			Node{Name: "bar", Children: []*Node{{}}},
+			true,
+		},
+		{
+			struct{ Name string }{},
+			struct{ Name int }{},
+			false,
+		},
+		{
+			struct{ Name string }{},
+			struct{ Other string }{},
+			false,
+		},
+		{
+			struct {
+				Name string `json:"name"`
+			}{},
+			struct {
+				Name string `json:"full_name"`
+			}{},
+			false,
+		},
+		{
+			struct {
+				Name   string
+				Ignore int `hash:"ignore"`
+				secret int
+			}{},
+			struct{ Name string }{},
+			true,
+		},
+		{map[string]int{}, map[string]uint{}, false},
+		{[2]int{}, [3]int{}, false},
+		{func(int) string { return "" }, func(string) int { return 0 }, false},
+
+		// Named types that refer to themselves
+		{Tree{}, Tree{"a": nil}, true},
+		{Tree{}, map[string]Tree{}, false},
+		{List{}, List{nil}, true},
+		{List{}, []List{}, false},
+		{Func(nil), Func(nil), true},
+		{Func(nil), func(Func) Func { return nil }, false},
+		{Chan(nil), chan Chan(nil), false},
+	}
+
+	for i, tc := range cases {
+		one, err := SchemaHash(reflect.TypeOf(tc.One), nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		two, err := SchemaHash(reflect.TypeOf(tc.Two), nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	if _, err := SchemaHash(nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_canonical(t *testing.T) {
+	type Wrapper struct {
+		Tags *testCanonical
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			testCanonical{Tags: []string{"b", "a"}},
+			testCanonical{Tags: []string{"a", "b"}},
+			true,
+		},
+		{
+			Wrapper{Tags: &testCanonical{Tags: []string{"b", "a"}}},
+			Wrapper{Tags: &testCanonical{Tags: []string{"a", "b"}}},
+			true,
+		},
+		{
+			testCanonical{Tags: []string{"a", "c"}},
+			testCanonical{Tags: []string{"a", "b"}},
+			false,
+		},
+		{
+			Wrapper{Tags: nil},
+			Wrapper{Tags: &testCanonical{}},
+			false,
+		},
+		{
+			[]interface{}{testCanonical{Tags: []string{"b", "a"}}},
+			[]interface{}{testCanonical{Tags: []string{"a", "b"}}},
+			true,
+		},
+		{
+			map[string]interface{}{"tags": &testCanonical{Tags: []string{"b", "a"}}},
+			map[string]interface{}{"tags": &testCanonical{Tags: []string{"a", "b"}}},
+			true,
+		},
+	}
+
+	opts := &HashOptions{UseCanonical: true}
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Without the option the value is hashed as is
+	one, err := Hash(testCanonical{Tags: []string{"b", "a"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(testCanonical{Tags: []string{"a", "b"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("expected Canonical to be ignored without UseCanonical")
+	}
+}
+
+func TestHash_rawMessage(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":1,"y":2}`)},
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":1,"y":2}`)},
+			&HashOptions{RawMessageBytes: true},
+			true,
+		},
+		{
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":1,"y":2}`)},
+			map[string]json.RawMessage{"a": json.RawMessage(`{"y": 2, "x": 1}`)},
+			&HashOptions{RawMessageBytes: true},
+			false,
+		},
+		{
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":1,"y":2}`)},
+			map[string]json.RawMessage{"a": json.RawMessage(`{"y": 2, "x": 1}`)},
+			&HashOptions{CanonicalRawMessages: true},
+			true,
+		},
+		{
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":1}`)},
+			map[string]json.RawMessage{"a": json.RawMessage(`{"x":2}`)},
+			&HashOptions{CanonicalRawMessages: true},
+			false,
+		},
+		{
+			json.RawMessage(`"foo"`),
+			RawBytes(`"foo"`),
+			&HashOptions{RawMessageBytes: true},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	opts := &HashOptions{CanonicalRawMessages: true}
+	if _, err := Hash(json.RawMessage(`{`), testFormat, opts); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
+
+func TestHash_fieldName(t *testing.T) {
+	yamlName := func(f reflect.StructField) (string, bool) {
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			return "", true
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name, false
+		}
+
+		return f.Name, false
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			struct {
+				Name string `yaml:"name"`
+			}{"foo"},
+			struct {
+				FullName string `yaml:"name,omitempty"`
+			}{"foo"},
+			true,
+		},
+		{
+			struct {
+				Name string `yaml:"name"`
+			}{"foo"},
+			struct {
+				Name string `yaml:"full_name"`
+			}{"foo"},
+			false,
+		},
+		{
+			struct {
+				Name  string
+				Cache string `yaml:"-"`
+			}{"foo", "bar"},
+			struct {
+				Name string
+			}{"foo"},
+			true,
+		},
+	}
+
+	opts := &HashOptions{FieldName: yamlName}
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_cycleShape(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+
+	// a -> b -> a
+	loop := func() *Node {
+		a := &Node{Name: "foo"}
+		a.Next = &Node{Name: "foo", Next: a}
+		return a
+	}
+
+	// a -> b -> b
+	self := &Node{Name: "foo", Next: &Node{Name: "foo"}}
+	self.Next.Next = self.Next
+
+	one, err := Hash(loop(), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(loop(), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatalf("equal cyclic values should hash equal: %d != %d", one, two)
+	}
+
+	three, err := Hash(self, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == three {
+		t.Fatal("cycles of different shapes should hash differently")
+	}
+
+	// Cycles reached through maps are deterministic too
+	m1 := map[string]interface{}{}
+	m1["a"] = map[string]interface{}{"b": m1, "c": []interface{}{m1}}
+	m2 := map[string]interface{}{}
+	m2["a"] = map[string]interface{}{"b": m2, "c": []interface{}{m2}}
+	if err := AssertConsistent(testFormat, nil, m1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	one, err = Hash(m1, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(m2, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatalf("equal cyclic maps should hash equal: %d != %d", one, two)
+	}
+}
+
+func TestHash_cycleTransformed(t *testing.T) {
+	type Ref struct{ ID int }
+	type Doc struct {
+		Name string
+		Ref  *Ref
+	}
+
+	// Neither type can refer to itself, but the transformer resolves the
+	// reference back to the document that contains it.
+	docs := map[int]*Doc{}
+	docs[1] = &Doc{Name: "foo", Ref: &Ref{ID: 1}}
+	opts := &HashOptions{
+		Transformers: map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(Ref{}): func(v interface{}) interface{} {
+				return docs[v.(Ref).ID]
+			},
+		},
+	}
+
+	if _, err := Hash(docs[1], testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func BenchmarkHash_nestedStruct(b *testing.B) {
+	type Leaf struct {
+		Name string
+		Tags []string
+		Meta map[string]int
+	}
+	type Branch struct {
+		Leaves []*Leaf
+		Index  map[string]*Leaf
+	}
+
+	v := &struct{ Branches []Branch }{}
+	for i := 0; i < 10; i++ {
+		var br Branch
+		br.Index = make(map[string]*Leaf)
+		for j := 0; j < 5; j++ {
+			l := &Leaf{Name: fmt.Sprint(i, j), Tags: []string{"a", "b"}, Meta: map[string]int{"n": j}}
+			br.Leaves = append(br.Leaves, l)
+			br.Index[l.Name] = l
+		}
+		v.Branches = append(v.Branches, br)
+	}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Hash(v, testFormat, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHash_distinctBools(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{true, int8(1), nil, true},
+		{true, int8(1), &HashOptions{DistinctBools: true}, false},
+		{false, int8(0), &HashOptions{DistinctBools: true}, false},
+		{true, true, &HashOptions{DistinctBools: true}, true},
+		{true, false, &HashOptions{DistinctBools: true}, false},
+		{
+			struct {
+				A bool
+				B int8
+			}{true, 1},
+			struct {
+				A int8
+				B bool
+			}{1, true},
+			&HashOptions{DistinctBools: true},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_multiset(t *testing.T) {
+	type Set struct {
+		Items []string `hash:"set"`
+	}
+	type Multiset struct {
+		Items []string `hash:"multiset"`
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Format   Format
+		Match    bool
+	}{
+		{Set{[]string{"a", "a", "b"}}, Set{[]string{"a", "b"}}, testFormat, true},
+		{Set{[]string{"a", "a", "b"}}, Set{[]string{"b", "a"}}, testFormat, true},
+		{Set{[]string{"a", "a", "b"}}, Set{[]string{"b"}}, testFormat, false},
+		{Set{[]string{"a", "a"}}, Set{[]string{"b", "b"}}, testFormat, false},
+
+		// FormatV1 keeps its old behavior
+		{Set{[]string{"a", "a", "b"}}, Set{[]string{"b"}}, FormatV1, true},
+
+		{Multiset{[]string{"a", "a", "b"}}, Multiset{[]string{"a", "b"}}, testFormat, false},
+		{Multiset{[]string{"a", "a", "b"}}, Multiset{[]string{"b", "a", "a"}}, testFormat, true},
+		{Multiset{[]string{"a", "a", "b"}}, Multiset{[]string{"b", "b", "a"}}, testFormat, false},
+		{Multiset{[]string{"a", "a"}}, Multiset{[]string{"b", "b"}}, testFormat, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, tc.Format, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, tc.Format, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_maxBytes(t *testing.T) {
+	cases := []struct {
+		Value    interface{}
+		MaxBytes int
+		Err      bool
+	}{
+		{"foo", 0, false},
+		{"foo", 100, false},
+		{strings.Repeat("a", 101), 100, true},
+		{make([]int, 100), 100, true},
+		{map[string]string{"foo": strings.Repeat("a", 200)}, 100, true},
+		{
+			struct {
+				A, B string
+			}{"foo", strings.Repeat("a", 200)},
+			100,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		expected, err := Hash(tc.Value, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Value, err)
+		}
+
+		actual, err := Hash(tc.Value, testFormat, &HashOptions{MaxBytes: tc.MaxBytes})
+		if tc.Err {
+			if _, ok := err.(*ErrTooLarge); !ok {
+				t.Fatalf("%d: expected ErrTooLarge, got: %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %s", i, err)
+		}
+
+		// The limit must not change the hash when it isn't reached
+		if actual != expected {
+			t.Fatalf("%d: hash changed: %d != %d", i, actual, expected)
+		}
+	}
+}
+
+func TestHash_regexp(t *testing.T) {
+	type Wrapper struct {
+		*regexp.Regexp
+	}
+	type Config struct {
+		Re regexp.Regexp
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{regexp.MustCompile("foo"), regexp.MustCompile("foo"), true},
+		{regexp.MustCompile("foo"), regexp.MustCompile("bar"), false},
+		{regexp.MustCompile(""), (*regexp.Regexp)(nil), false},
+		{Wrapper{regexp.MustCompile("foo")}, Wrapper{regexp.MustCompile("foo")}, true},
+		{Wrapper{regexp.MustCompile("foo")}, Wrapper{regexp.MustCompile("bar")}, false},
+		{Wrapper{regexp.MustCompile("")}, Wrapper{}, false},
+		{Config{*regexp.MustCompile("foo")}, Config{*regexp.MustCompile("foo")}, true},
+		{Config{*regexp.MustCompile("foo")}, Config{*regexp.MustCompile("bar")}, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// FormatV1 never changes, so it still hashes the unexported state,
+	// which is nothing
+	v1 := []struct{ One, Two interface{} }{
+		{regexp.MustCompile("foo"), regexp.MustCompile("bar")},
+		{Wrapper{regexp.MustCompile("foo")}, Wrapper{regexp.MustCompile("bar")}},
+		{Config{*regexp.MustCompile("foo")}, Config{*regexp.MustCompile("bar")}},
+	}
+	for i, tc := range v1 {
+		one, err := Hash(tc.One, FormatV1, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, FormatV1, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+		if one != two {
+			t.Fatalf("%d: FormatV1 hash changed", i)
+		}
+	}
+}
+
+func TestHash_stringerWrapper(t *testing.T) {
+	type Wrapper struct {
+		Re testPtrStringer `hash:"string"`
+	}
+
+	one, err := Hash(&Wrapper{testPtrStringer{"foo"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(&Wrapper{testPtrStringer{"bar"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("values with different strings should hash differently")
+	}
+
+	// Without the tag, the wrapped value contributes nothing, which is
+	// reported to OnIgnore.
+	type Plain struct {
+		Re testPtrStringer
+	}
+
+	var ignored []string
+	opts := &HashOptions{
+		OnIgnore: func(path, reason string) {
+			ignored = append(ignored, path+":"+reason)
+		},
+	}
+	if _, err := Hash(&Plain{testPtrStringer{"foo"}}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"Re:stringer", "Re.pattern:unexported"}
+	if !reflect.DeepEqual(ignored, expected) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+
+	// UseStringer only uses String methods with value receivers, as it
+	// always has, so the wrapped value still contributes nothing
+	opts = &HashOptions{UseStringer: true}
+	one, err = Hash(&Plain{testPtrStringer{"foo"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(&Plain{testPtrStringer{"bar"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("UseStringer used a pointer receiver String method")
+	}
+}
+
+type testPtrStringer struct {
+	pattern string
+}
+
+func (s *testPtrStringer) String() string {
+	return s.pattern
+}
+
+func TestHash_url(t *testing.T) {
+	type Config struct {
+		Endpoint *url.URL
+		Proxy    url.URL
+	}
+
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return u
+	}
+
+	opts := &HashOptions{URLsAsStrings: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{parse("http://example.com/a"), parse("http://example.com/a"), opts, true},
+		{parse("http://example.com/a"), parse("http://example.com/b"), opts, false},
+		{parse("http://user@example.com"), parse("http://example.com"), opts, false},
+		{&url.URL{Scheme: "http", Host: "example.com", Path: "/a b"}, parse("http://example.com/a%20b"), opts, true},
+		{&url.URL{}, (*url.URL)(nil), opts, false},
+		{&url.URL{Scheme: "http", Host: "example.com", Path: "/a", RawPath: "/a"}, parse("http://example.com/a"), opts, true},
+		{Config{Proxy: *parse("http://a")}, Config{Proxy: *parse("http://a")}, opts, true},
+		{Config{Proxy: *parse("http://a")}, Config{Proxy: *parse("http://b")}, opts, false},
+		{Config{Endpoint: parse("")}, Config{}, opts, false},
+
+		// It is off by default, so the fields are hashed
+		{&url.URL{Scheme: "http", Host: "example.com", Path: "/a", RawPath: "/a"}, parse("http://example.com/a"), nil, false},
+		{parse("http://example.com/a"), parse("http://example.com/b"), nil, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_fallback(t *testing.T) {
+	type Job struct {
+		Name string
+		Done chan struct{}
+	}
+
+	// Without a fallback chans are an error
+	if _, err := Hash(Job{Name: "foo"}, testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	opts := &HashOptions{
+		Fallback: func(v reflect.Value) (uint64, bool, error) {
+			if v.Kind() != reflect.Chan {
+				return 0, false, nil
+			}
+
+			return uint64(v.Cap()), true, nil
+		},
+	}
+
+	one, err := Hash(Job{Name: "foo", Done: make(chan struct{})}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Job{Name: "foo", Done: make(chan struct{})}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("hashes should match")
+	}
+
+	three, err := Hash(Job{Name: "foo", Done: make(chan struct{}, 1)}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == three {
+		t.Fatal("hashes should not match")
+	}
+
+	// Unhandled kinds are still an error
+	if _, err := Hash(func() {}, testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_byteArray(t *testing.T) {
+	type ID [4]byte
+	type Record struct {
+		ID [4]byte
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Format   Format
+		Match    bool
+	}{
+		{[4]byte{1, 2, 3, 4}, [4]byte{1, 2, 3, 4}, testFormat, true},
+		{[4]byte{1, 2, 3, 4}, [4]byte{1, 2, 3, 5}, testFormat, false},
+		{[4]byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}, testFormat, false},
+		{[4]byte{1, 2, 3, 4}, RawBytes{1, 2, 3, 4}, testFormat, false},
+		{[2]byte{0, 0}, [3]byte{0, 0, 0}, testFormat, false},
+		{&Record{[4]byte{1, 2, 3, 4}}, Record{[4]byte{1, 2, 3, 4}}, testFormat, true},
+		{&Record{[4]byte{1, 2, 3, 4}}, Record{[4]byte{4, 3, 2, 1}}, testFormat, false},
+		{ID{1, 2, 3, 4}, ID{1, 2, 3, 4}, testFormat, true},
+
+		// FormatV1 keeps hashing element by element
+		{[4]byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}, FormatV1, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, tc.Format, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, tc.Format, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// A Marshaler only replaces the byte arrays it handles, and the rest
+	// are still written all at once
+	opts := &HashOptions{Marshaler: func(v interface{}) ([]byte, bool, error) {
+		if _, ok := v.(ID); ok {
+			return []byte("id"), true, nil
+		}
+		return nil, false, nil
+	}}
+	for i, v := range []interface{}{
+		[4]byte{1, 2, 3, 4},
+		Record{[4]byte{1, 2, 3, 4}},
+		&Record{[4]byte{1, 2, 3, 4}},
+		[16]byte{},
+	} {
+		one, err := Hash(v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", v, err)
+		}
+		two, err := Hash(v, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", v, err)
+		}
+		if one != two {
+			t.Fatalf("%d: %#v hashed differently with a Marshaler", i, v)
+		}
+	}
+
+	one, err := Hash(ID{1, 2, 3, 4}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(RawBytes("id"), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("ID wasn't hashed by the Marshaler")
+	}
+}
+
+func BenchmarkHash_byteArray(b *testing.B) {
+	v := struct {
+		IDs [][16]byte
+	}{make([][16]byte, 100)}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Hash(v, testFormat, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHash_ignoreEmptyCollections(t *testing.T) {
+	// Struct names are hashed, so declare the old version of the struct
+	// in its own scope with the same name.
+	var before interface{}
+	{
+		type After struct {
+			Name string
+		}
+		before = After{Name: "foo"}
+	}
+
+	type After struct {
+		Name  string
+		Tags  []string
+		Attrs map[string]string
+	}
+
+	opts := &HashOptions{IgnoreEmptyCollections: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{After{Name: "foo"}, After{Name: "foo", Tags: []string{}, Attrs: map[string]string{}}, opts, true},
+		{After{Name: "foo"}, After{Name: "foo", Tags: []string{}}, nil, true},
+		{After{Name: "foo"}, After{Name: "foo", Tags: []string{"a"}}, opts, false},
+		{After{Name: "foo"}, After{Name: "foo", Attrs: map[string]string{"a": "b"}}, opts, false},
+
+		// Adding fields that are empty doesn't change the hash
+		{before, After{Name: "foo"}, opts, true},
+		{before, After{Name: "foo", Tags: []string{}}, opts, true},
+		{before, After{Name: "foo"}, nil, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_prune(t *testing.T) {
+	type Inner struct {
+		A, B string
+	}
+	type Outer struct {
+		Inner Inner
+		List  []string
+		Map   map[string]string
+	}
+
+	one := Outer{
+		Inner: Inner{A: "a", B: "b"},
+		List:  []string{"a", "b"},
+		Map:   map[string]string{"a": "a", "b": "b"},
+	}
+
+	cases := []struct {
+		Two   Outer
+		Prune func(string) bool
+		Match bool
+	}{
+		{
+			Outer{Inner: Inner{A: "a", B: "x"}, List: one.List, Map: one.Map},
+			func(p string) bool { return p == "Inner.B" },
+			true,
+		},
+		{
+			Outer{Inner: Inner{A: "x", B: "b"}, List: one.List, Map: one.Map},
+			func(p string) bool { return p == "Inner.B" },
+			false,
+		},
+		{
+			Outer{Inner: Inner{A: "x", B: "x"}, List: one.List, Map: one.Map},
+			func(p string) bool { return p == "Inner" },
+			true,
+		},
+		{
+			Outer{Inner: one.Inner, List: []string{"a", "x"}, Map: one.Map},
+			func(p string) bool { return p == "List[1]" },
+			true,
+		},
+		{
+			Outer{Inner: one.Inner, List: one.List, Map: map[string]string{"a": "a", "b": "x"}},
+			func(p string) bool { return p == "Map[b]" },
+			true,
+		},
+		{
+			Outer{Inner: one.Inner, List: one.List, Map: map[string]string{"a": "x", "b": "b"}},
+			func(p string) bool { return p == "Map[b]" },
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		var ignored []string
+		opts := &HashOptions{
+			Prune: tc.Prune,
+			OnIgnore: func(path, reason string) {
+				ignored = append(ignored, path+":"+reason)
+			},
+		}
+
+		h1, err := Hash(one, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", one, err)
+		}
+		if len(ignored) != 1 || !strings.HasSuffix(ignored[0], ":prune") {
+			t.Fatalf("%d: bad ignored: %#v", i, ignored)
+		}
+
+		h2, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (h1 == h2) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, one, tc.Two)
+		}
+	}
+}
+
+func TestHash_stringSet(t *testing.T) {
+	set := func(members ...string) map[string]struct{} {
+		result := make(map[string]struct{}, len(members))
+		for _, m := range members {
+			result[m] = struct{}{}
+		}
+		return result
+	}
+
+	members := []string{"a", "b", "c", "d", "e", "f"}
+	full, err := Hash(set(members...), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Same members in a different insertion order hash equal
+	reversed := make([]string, len(members))
+	for i, m := range members {
+		reversed[len(members)-1-i] = m
+	}
+	if h, err := Hash(set(reversed...), testFormat, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	} else if h != full {
+		t.Fatal("sets with the same members should hash equal")
+	}
+
+	// Every proper subset hashes differently, and differently from each
+	// other.
+	seen := map[uint64]int{full: 1<<uint(len(members)) - 1}
+	for mask := 0; mask < 1<<uint(len(members))-1; mask++ {
+		var subset []string
+		for i, m := range members {
+			if mask&(1<<uint(i)) != 0 {
+				subset = append(subset, m)
+			}
+		}
+
+		h, err := Hash(set(subset...), testFormat, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if other, ok := seen[h]; ok {
+			t.Fatalf("subsets %b and %b hash equal", mask, other)
+		}
+		seen[h] = mask
+	}
+}
+
+func TestHash_pointerChains(t *testing.T) {
+	type T struct {
+		A int
+	}
+
+	value := T{A: 42}
+	ptr := &value
+	var iface interface{} = ptr
+	var nilPtr *T
+	var nilIface interface{} = nilPtr
+	var nilPtrPtr **T
+	var nilIfacePtr *interface{}
+
+	cases := []struct {
+		One, Two interface{}
+		ZeroNil  bool
+		Match    bool
+	}{
+		// Non-nil chains hash like the value they point to
+		{value, &ptr, false, true},
+		{value, &iface, false, true},
+		{value, &[]interface{}{&ptr}[0], false, true},
+
+		// A nil anywhere in the chain hashes like a zero int
+		{0, nilPtr, false, true},
+		{0, &nilPtr, false, true},
+		{0, nilPtrPtr, false, true},
+		{0, nilIface, false, true},
+		{0, &nilIface, false, true},
+		{0, nilIfacePtr, false, true},
+
+		// With ZeroNil, a nil hashes like the zero value of the innermost
+		// type it can be resolved to
+		{T{}, nilPtr, true, true},
+		{T{}, &nilPtr, true, true},
+		{T{}, nilPtrPtr, true, true},
+		{T{}, nilIface, true, true},
+		{T{}, &nilIface, true, true},
+		{0, nilIfacePtr, true, true},
+		{T{}, 0, true, false},
+	}
+
+	for i, tc := range cases {
+		opts := &HashOptions{ZeroNil: tc.ZeroNil}
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: failed to hash %#v: %s", i, tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: failed to hash %#v: %s", i, tc.Two, err)
+		}
+
+		// Hashing again must give the same result
+		again, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: failed to hash %#v: %s", i, tc.Two, err)
+		}
+		if again != two {
+			t.Fatalf("%d: non-deterministic hash for %#v", i, tc.Two)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_useGetters(t *testing.T) {
+	opts := &HashOptions{UseGetters: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{testGetters{name: "foo", age: 1}, testGetters{name: "bar", age: 1}, nil, true},
+		{testGetters{name: "foo", age: 1}, testGetters{name: "bar", age: 1}, opts, false},
+		{testGetters{name: "foo", age: 1}, testGetters{name: "foo", age: 2}, opts, true},
+		{&testGetters{name: "foo", age: 1}, &testGetters{name: "foo", age: 2}, opts, false},
+		{testGetters{name: "foo", age: 1}, testGetters{name: "foo", age: 1, other: 2}, opts, true},
+		{&testGetters{name: "foo", age: 1}, testGetters{name: "foo", age: 1}, opts, false},
+		{&testGetters{name: "foo", age: 1}, &testGetters{name: "foo", age: 1}, opts, true},
+		{
+			struct{ G testGetters }{testGetters{name: "foo"}},
+			struct{ G testGetters }{testGetters{name: "bar"}},
+			opts,
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_useGettersCycle(t *testing.T) {
+	opts := &HashOptions{UseGetters: true}
+	for i, v := range []interface{}{
+		testSelfGetter{n: 1},
+		&testSelfGetter{n: 1},
+		struct{ G testSelfGetter }{testSelfGetter{n: 1}},
+	} {
+		_, err := Hash(v, testFormat, opts)
+		if _, ok := err.(*ErrGetterCycle); !ok {
+			t.Fatalf("%d: bad error: %v", i, err)
+		}
+	}
+
+	// Chains of pointers end
+	list := &testListGetter{n: 1, next: &testListGetter{n: 2}}
+	one, err := Hash(list, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	list.next.n = 3
+	two, err := Hash(list, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("getters of the next element should be hashed")
+	}
+}
+
+// testSelfGetter has a getter that returns its own type by value.
+type testSelfGetter struct {
+	n int
+}
+
+func (g testSelfGetter) GetNext() testSelfGetter { return testSelfGetter{n: g.n + 1} }
+
+// testListGetter is a list behind getter methods.
+type testListGetter struct {
+	n    int
+	next *testListGetter
+}
+
+func (l *testListGetter) GetN() int                { return l.n }
+func (l *testListGetter) GetNext() *testListGetter { return l.next }
+
+// testGetters hides its state behind getter methods.
+type testGetters struct {
+	name  string
+	age   int
+	other int
+}
+
+func (g testGetters) GetName() string { return g.name }
+
+// GetAge has a pointer receiver so it's only used when addressable.
+func (g *testGetters) GetAge() int { return g.age }
+
+// Other isn't a getter since it doesn't start with Get.
+func (g testGetters) Other() int { return g.other }
+
+// GetOther isn't a getter since it takes an argument.
+func (g testGetters) GetOther(scale int) int { return g.other * scale }
+
+func TestRegisterType(t *testing.T) {
+	type Event struct {
+		At time.Time
+	}
+
+	byUnixNano := func(v interface{}) interface{} {
+		return v.(time.Time).UnixNano()
+	}
+	RegisterType(timeType, byUnixNano)
+	defer RegisterType(timeType, nil)
+
+	now := time.Now()
+	utc := now.UTC()
+
+	// The location no longer affects the hash of nested times
+	one, err := Hash(Event{At: now}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Event{At: utc}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("registered transformer should make times hash by instant")
+	}
+
+	// Pointers to registered types are dereferenced first
+	three, err := Hash(&now, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	four, err := Hash(now.UnixNano(), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if three != four {
+		t.Fatal("pointer should hash like the transformed value")
+	}
+
+	// Transformers in the options take precedence
+	opts := &HashOptions{
+		Transformers: map[reflect.Type]func(interface{}) interface{}{
+			timeType: func(v interface{}) interface{} {
+				return v.(time.Time).Location().String()
+			},
+		},
+	}
+	one, err = Hash(now, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(now.Location().String(), testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("option transformer should take precedence")
+	}
+
+	// Removing the transformer restores the default
+	RegisterType(timeType, nil)
+	one, err = Hash(Event{At: now}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(Event{At: utc}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("times in different locations should hash differently")
+	}
+}
+
+func TestHash_ignoreUnexportedStructs(t *testing.T) {
+	type Client struct {
+		Name string
+		Conn testOpaque
+	}
+
+	var ignored []string
+	opts := &HashOptions{
+		IgnoreUnexportedStructs: true,
+		OnIgnore: func(path, reason string) {
+			ignored = append(ignored, path+":"+reason)
+		},
+	}
+
+	one, err := Hash(Client{Name: "foo", Conn: testOpaque{addr: "a"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Client{Name: "foo", Conn: testOpaque{addr: "b"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("opaque structs should not affect the hash")
+	}
+
+	expected := []string{"Conn:opaque", "Conn:opaque"}
+	if !reflect.DeepEqual(ignored, expected) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+
+	// The opaque struct is hashed differently than it is by default
+	three, err := Hash(Client{Name: "foo", Conn: testOpaque{addr: "a"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == three {
+		t.Fatal("opaque structs should be hashed as a marker")
+	}
+
+	// Structs with exported fields and empty structs are still walked
+	ignored = nil
+	if _, err := Hash(map[string]struct{}{"foo": {}}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(ignored) != 0 {
+		t.Fatalf("bad: %#v", ignored)
+	}
+}
+
+// testOpaque is a struct with only unexported fields.
+type testOpaque struct {
+	addr string
+}
+
+func TestCombine(t *testing.T) {
+	items := []string{"foo", "bar", "baz", "foo"}
+
+	var hs []uint64
+	for _, item := range items {
+		h, err := Hash(item, FormatV2, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		hs = append(hs, h)
+	}
+
+	// The combined hashes match the hashes of the equivalent slices
+	ordered, err := Hash(items, FormatV2, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := CombineOrdered(hs...); actual != ordered {
+		t.Fatalf("bad: %d != %d", actual, ordered)
+	}
+
+	// Sets are only hashed as such within structs, so compare against a
+	// struct whose field hashes itself to the combined hash.
+	set, err := Hash(struct {
+		Items []string `hash:"set"`
+	}{items}, FormatV2, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	combined, err := Hash(struct {
+		Items testFixedHash
+	}{testFixedHash{CombineUnordered(hs...)}}, FormatV2, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if combined != set {
+		t.Fatalf("bad: %d != %d", combined, set)
+	}
+
+	// Ordering only matters for CombineOrdered
+	a, b, c := hs[0], hs[1], hs[2]
+	if CombineOrdered(a, b) == CombineOrdered(b, a) {
+		t.Fatal("ordered combine should depend on order")
+	}
+	if CombineUnordered(a, b, c) != CombineUnordered(c, a, b) {
+		t.Fatal("unordered combine should not depend on order")
+	}
+
+	// Duplicates only matter for CombineOrdered
+	if CombineOrdered(a, a) == CombineOrdered(a) {
+		t.Fatal("ordered combine should count duplicates")
+	}
+	if CombineUnordered(a, a, b) != CombineUnordered(a, b) {
+		t.Fatal("unordered combine should ignore duplicates")
+	}
+	if CombineUnordered(a, b) == CombineUnordered(a) {
+		t.Fatal("unordered combine should differ from subsets")
+	}
+}
+
+// testFixedHash is a Hashable that returns a fixed hash.
+type testFixedHash struct {
+	Value uint64
+}
+
+func (t testFixedHash) Hash() (uint64, error) {
+	return t.Value, nil
+}
+
+func TestHash_markerTypes(t *testing.T) {
+	type Capability interface{}
+	type Read struct{}
+	type Write struct{}
+
+	for _, opts := range []*HashOptions{nil, {NamedTypeIdentity: true}} {
+		one, err := Hash([]Capability{Read{}}, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		two, err := Hash([]Capability{Write{}}, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if one == two {
+			t.Fatalf("marker types should hash differently with %#v", opts)
+		}
+
+		// Capability sets are independent of order
+		two, err = Hash(struct {
+			Caps []Capability `hash:"set"`
+		}{[]Capability{Write{}, Read{}}}, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		three, err := Hash(struct {
+			Caps []Capability `hash:"set"`
+		}{[]Capability{Read{}, Write{}}}, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if two != three {
+			t.Fatalf("capability sets should hash equal with %#v", opts)
+		}
+	}
+
+	// NamedTypeIdentity qualifies struct names by package
+	one, err := Hash(Read{}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Read{}, testFormat, &HashOptions{NamedTypeIdentity: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("package path should be part of the hash")
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	var calls int
+	opts := WithHasher(func() hash.Hash64 {
+		calls++
+		return fnv.New64a()
+	}).WithTagName("custom").WithZeroNil(true)
+
+	type Foo struct {
+		Name string `custom:"ignore"`
+		Ptr  *int
+	}
+
+	one, err := Hash(Foo{Name: "foo"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Foo{Name: "bar", Ptr: new(int)}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("hashes should match")
+	}
+
+	if calls != 2 {
+		t.Fatalf("factory should be called for every hash, got %d calls", calls)
+	}
+	if opts.Hasher != nil {
+		t.Fatal("Hasher should not be set when using a factory")
+	}
+
+	expected, err := Hash(Foo{Name: "foo"}, testFormat, &HashOptions{
+		Hasher:  fnv.New64a(),
+		TagName: "custom",
+		ZeroNil: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != expected {
+		t.Fatal("options should match the equivalent literal")
+	}
+
+	// Chaining works from nil options too
+	var nilOpts *HashOptions
+	if o := nilOpts.WithSlicesAsSets(true); o == nil || !o.SlicesAsSets {
+		t.Fatalf("bad: %#v", o)
+	}
+}
+
+func TestHash_parallel(t *testing.T) {
+	m := make(map[string]interface{})
+	for i := 0; i < 5000; i++ {
+		m[fmt.Sprintf("key%d", i)] = map[string]interface{}{
+			"index": i,
+			"tags":  []string{"a", fmt.Sprint(i)},
+		}
+	}
+
+	cases := []*HashOptions{
+		{},
+		{OrderedMaps: true},
+		{HasherFactory: fnv.New64a},
+		{Hasher: fnv.New64()},
+	}
+
+	for i, opts := range cases {
+		expected, err := Hash(m, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		opts.Parallel = true
+		actual, err := Hash(m, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		if actual != expected {
+			t.Fatalf("%d: parallel hash differs: %d != %d", i, actual, expected)
+		}
+	}
+}
+
+func TestHash_platformInts(t *testing.T) {
+	// expected is the hash of v written as 8 bytes in the given order,
+	// which is what ints of every size must hash as on every platform.
+	expected := func(order binary.ByteOrder, v uint64) uint64 {
+		b := make([]byte, 8)
+		order.PutUint64(b, v)
+
+		h := fnv.New64()
+		h.Write(b)
+		return h.Sum64()
+	}
+
+	minInt32, maxInt32 := int64(math.MinInt32), int64(math.MaxInt32)
+	cases := []struct {
+		Value    interface{}
+		Expected uint64
+	}{
+		{int(0), 0},
+		{int(1), 1},
+		{int(-1), math.MaxUint64},
+		{int(math.MinInt32), uint64(minInt32)},
+		{int(math.MaxInt32), uint64(maxInt32)},
+		{int64(math.MinInt64), 1 << 63},
+		{uint(math.MaxUint32), math.MaxUint32},
+		{uintptr(math.MaxUint32), math.MaxUint32},
+		{uint64(math.MaxUint64), math.MaxUint64},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for i, tc := range cases {
+			actual, err := Hash(tc.Value, testFormat, &HashOptions{ByteOrder: order})
+			if err != nil {
+				t.Fatalf("%d: err: %s", i, err)
+			}
+
+			if e := expected(order, tc.Expected); actual != e {
+				t.Fatalf("%d: bad hash for %#v with %s: %d != %d", i, tc.Value, order, actual, e)
+			}
+		}
+	}
+}
+
+func TestHash_bytesTag(t *testing.T) {
+	type Payload []byte
+	type Digest [4]byte
+	type Message struct {
+		Payload Payload `hash:"bytes"`
+		Digest  Digest  `hash:"bytes"`
+	}
+	type Untagged struct {
+		Payload Payload
+		Digest  Digest
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			Message{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			Message{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			true,
+		},
+		{
+			Message{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			Message{Payload{2, 1}, Digest{1, 2, 3, 4}},
+			false,
+		},
+		{
+			Message{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			Message{Payload{1, 2}, Digest{4, 3, 2, 1}},
+			false,
+		},
+		{
+			Message{Payload: Payload{}},
+			Message{Payload: nil},
+			true,
+		},
+		{
+			Message{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			Untagged{Payload{1, 2}, Digest{1, 2, 3, 4}},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// The field is hashed like RawBytes
+	one, err := Hash(struct {
+		Digest *Digest `hash:"bytes"`
+	}{&Digest{1, 2, 3, 4}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(struct {
+		Digest RawBytes
+	}{RawBytes{1, 2, 3, 4}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("bytes tag should hash like RawBytes")
+	}
+
+	// Other types are an error
+	_, err = Hash(struct {
+		Values []int `hash:"bytes"`
+	}{}, testFormat, nil)
+	if _, ok := err.(*ErrNotBytes); !ok {
+		t.Fatalf("expected ErrNotBytes, got: %v", err)
+	}
+}
+
+func TestHash_useGoStringer(t *testing.T) {
+	opts := &HashOptions{UseGoStringer: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{testGoStringer{ID: 1, Cache: "a"}, testGoStringer{ID: 1, Cache: "b"}, nil, false},
+		{testGoStringer{ID: 1, Cache: "a"}, testGoStringer{ID: 1, Cache: "b"}, opts, true},
+		{testGoStringer{ID: 1}, testGoStringer{ID: 2}, opts, false},
+		{testGoStringer{ID: 1}, "testGoStringer(1)", opts, true},
+		{&testGoStringer{ID: 1}, testGoStringer{ID: 1}, opts, true},
+		{
+			struct{ V *testGoStringer }{&testGoStringer{ID: 1, Cache: "a"}},
+			struct{ V *testGoStringer }{&testGoStringer{ID: 1, Cache: "b"}},
+			opts,
+			true,
+		},
+		{
+			struct{ V *testGoStringer }{nil},
+			struct{ V *testGoStringer }{&testGoStringer{}},
+			opts,
+			false,
+		},
+		{
+			[]interface{}{testGoStringer{ID: 1, Cache: "a"}},
+			[]interface{}{testGoStringer{ID: 1, Cache: "b"}},
+			opts,
+			true,
+		},
+		{[]interface{}{testGoStringer{ID: 1}}, []interface{}{"testGoStringer(1)"}, opts, true},
+		{
+			map[string]interface{}{"v": &testGoStringer{ID: 1, Cache: "a"}},
+			map[string]interface{}{"v": &testGoStringer{ID: 1, Cache: "b"}},
+			opts,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+// testGoStringer is identified by its ID alone.
+type testGoStringer struct {
+	ID    int
+	Cache string
+}
+
+func (g testGoStringer) GoString() string {
+	return fmt.Sprintf("testGoStringer(%d)", g.ID)
+}
+
+func TestHash_skipNaN(t *testing.T) {
+	nan := math.NaN()
+	opts := &HashOptions{SkipNaN: true}
+
+	type Reading struct {
+		Name  string
+		Value float64
+	}
+
+	nanKeys := map[float64]string{nan: "a", 1: "b"}
+	nanKeys[nan] = "c"
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{[]float64{1, nan, 2}, []float64{1, 2}, opts, true},
+		{[]float64{1, nan, 2}, []float64{1, 2}, nil, false},
+		{[]interface{}{1.0, nan}, []interface{}{1.0}, opts, true},
+		{[2]float64{nan, 1}, [1]float64{1}, opts, true},
+		{map[string]float64{"a": 1, "b": nan}, map[string]float64{"a": 1}, opts, true},
+		{map[string]float64{"a": 1, "b": nan}, map[string]float64{"a": 1}, nil, false},
+		{nanKeys, map[float64]string{1: "b"}, opts, true},
+		{Reading{"foo", nan}, Reading{Name: "foo"}, opts, false},
+		{[]complex64{complex(float32(nan), 0), 1}, []complex64{1}, opts, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Hashes must be repeatable
+		if err := AssertConsistent(testFormat, tc.Opts, tc.One); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// A NaN field is skipped like an ignored field
+	one, err := Hash(struct {
+		Name  string
+		Value float64
+	}{"foo", nan}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(struct {
+		Name string
+	}{"foo"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("NaN fields should be skipped")
+	}
+}
+
+func TestHash_unsupportedKind(t *testing.T) {
+	type Job struct {
+		Steps []chan int
+	}
+
+	cases := []struct {
+		Value interface{}
+		Kind  reflect.Kind
+		Path  string
+	}{
+		{make(chan int), reflect.Chan, ""},
+		{Job{Steps: []chan int{nil, make(chan int)}}, reflect.Chan, "Steps[0]"},
+		{map[string]interface{}{"f": func() {}}, reflect.Func, "[f]"},
+	}
+
+	for i, tc := range cases {
+		_, err := Hash(tc.Value, testFormat, nil)
+		euk, ok := err.(*ErrUnsupportedKind)
+		if !ok {
+			t.Fatalf("%d: expected ErrUnsupportedKind, got: %v", i, err)
+		}
+
+		if euk.Kind != tc.Kind || euk.Path != tc.Path {
+			t.Fatalf("%d: bad: %#v", i, euk)
+		}
+	}
+}
+
+func TestHash_rotinvariant(t *testing.T) {
+	type Ring struct {
+		Items []string `hash:"rotinvariant"`
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{Ring{[]string{"a", "b", "c"}}, Ring{[]string{"a", "b", "c"}}, true},
+		{Ring{[]string{"a", "b", "c"}}, Ring{[]string{"b", "c", "a"}}, true},
+		{Ring{[]string{"a", "b", "c"}}, Ring{[]string{"c", "a", "b"}}, true},
+		{Ring{[]string{"a", "b", "c"}}, Ring{[]string{"a", "c", "b"}}, false},
+		{Ring{[]string{"a", "a", "b"}}, Ring{[]string{"a", "b", "a"}}, true},
+		{Ring{[]string{"a", "a", "b"}}, Ring{[]string{"a", "b", "b"}}, false},
+		{Ring{[]string{"a", "b"}}, Ring{[]string{"a", "b", "a", "b"}}, false},
+		{Ring{[]string{}}, Ring{nil}, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestLeastRotation(t *testing.T) {
+	// naive compares every rotation
+	naive := func(hs []uint64) int {
+		best := 0
+		for start := 1; start < len(hs); start++ {
+			for i := range hs {
+				a, b := hs[(start+i)%len(hs)], hs[(best+i)%len(hs)]
+				if a != b {
+					if a < b {
+						best = start
+					}
+					break
+				}
+			}
+		}
+		return best
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		hs := make([]uint64, 1+r.Intn(10))
+		for j := range hs {
+			hs[j] = uint64(r.Intn(3))
+		}
+
+		if actual, expected := leastRotation(hs), naive(hs); actual != expected {
+			t.Fatalf("bad rotation for %v: %d != %d", hs, actual, expected)
+		}
+	}
+}
+
+func TestHash_resetPolicy(t *testing.T) {
+	seeded := func(seed string) hash.Hash64 {
+		h := fnv.New64()
+		h.Write([]byte(seed))
+		return h
+	}
+
+	sum := func(h hash.Hash64, policy ResetPolicy, v interface{}) uint64 {
+		result, err := Hash(v, testFormat, &HashOptions{Hasher: h, ResetPolicy: policy})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		return result
+	}
+
+	// By default the seed is discarded
+	if sum(seeded("a"), ResetAlways, "foo") != sum(seeded("b"), ResetAlways, "foo") {
+		t.Fatal("seed should be discarded")
+	}
+
+	// With ResetNever the seed matters
+	if sum(seeded("a"), ResetNever, "foo") == sum(seeded("b"), ResetNever, "foo") {
+		t.Fatal("seed should be folded in")
+	}
+	if sum(seeded("a"), ResetNever, "foo") != sum(seeded("a"), ResetNever, "foo") {
+		t.Fatal("same seed should hash the same")
+	}
+	if sum(seeded("a"), ResetNever, "foo") == sum(seeded("a"), ResetNever, "bar") {
+		t.Fatal("value should still matter")
+	}
+
+	// Hashers that are created rather than given have no seed
+	for _, opts := range []*HashOptions{
+		{},
+		{HasherFactory: func() hash.Hash64 { return seeded("a") }},
+		{HMACKey: []byte("key")},
+	} {
+		always, err := Hash("foo", testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		opts.ResetPolicy = ResetNever
+		never, err := Hash("foo", testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if always != never {
+			t.Fatalf("%#v: ResetNever changed the hash of a new hasher", opts)
+		}
+	}
+
+	// It also applies to CanonicalJSON
+	one, err := Hash("foo", testFormat, &HashOptions{Hasher: seeded("a"), ResetPolicy: ResetNever, CanonicalJSON: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash("foo", testFormat, &HashOptions{Hasher: seeded("b"), ResetPolicy: ResetNever, CanonicalJSON: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("seed should be folded in")
+	}
+
+	// The fold isn't affected by MaxBytes and BufferSize
+	for _, v := range []string{"aaaa", "bbbb"} {
+		expected := sum(seeded("a"), ResetNever, v)
+		for n := 1; n <= 32; n++ {
+			for _, opts := range []*HashOptions{
+				{Hasher: seeded("a"), ResetPolicy: ResetNever, MaxBytes: n},
+				{Hasher: seeded("a"), ResetPolicy: ResetNever, BufferSize: n},
+				{Hasher: seeded("a"), ResetPolicy: ResetNever, MaxBytes: n, BufferSize: n},
+			} {
+				actual, err := Hash(v, testFormat, opts)
+				if _, ok := err.(*ErrTooLarge); ok && opts.MaxBytes > 0 {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if actual != expected {
+					t.Fatalf("%q: MaxBytes %d, BufferSize %d changed the hash", v, opts.MaxBytes, opts.BufferSize)
+				}
+			}
+		}
+	}
+}
+
+func TestHash_scalarCategories(t *testing.T) {
+	// These have the same bytes: 8 little endian bytes of 0x31
+	s := "1\x00\x00\x00\x00\x00\x00\x00"
+	n := int64(0x31)
+	u := uint64(0x31)
+	f := math.Float64frombits(0x31)
+
+	opts := &HashOptions{ScalarCategories: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{s, n, nil, true},
+		{n, u, nil, true},
+		{u, f, nil, true},
+		{s, n, opts, false},
+		{n, u, opts, false},
+		{u, f, opts, false},
+		{true, int8(1), opts, false},
+		{n, n, opts, true},
+		{[]interface{}{1, "1", 1.0}, []interface{}{"1", 1, 1.0}, opts, false},
+		{[]interface{}{s, n}, []interface{}{n, s}, nil, true},
+		{[]interface{}{s, n}, []interface{}{n, s}, opts, false},
+
+		// Composes with CanonicalNumbers
+		{int8(1), uint64(1), &HashOptions{ScalarCategories: true, CanonicalNumbers: true}, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_nameTag(t *testing.T) {
+	type V1 struct {
+		UserName string `json:"user_name"`
+		Tags     []string
+	}
+
+	// Renaming the Go field keeps the hash when the json name stays
+	var v2 interface{}
+	{
+		type V1 struct {
+			Login string `json:"user_name,omitempty"`
+			Tags  []string
+		}
+		v2 = V1{Login: "foo", Tags: []string{"a"}}
+	}
+
+	opts := &HashOptions{NameTag: "json"}
+	one, err := Hash(V1{UserName: "foo", Tags: []string{"a"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(v2, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("fields with the same json name should hash the same")
+	}
+
+	// Without the option the Go names are used
+	one, err = Hash(V1{UserName: "foo", Tags: []string{"a"}}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(v2, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("fields with different Go names should hash differently")
+	}
+
+	// Mode options still come from the hash tag
+	type Ignored struct {
+		Name   string
+		Secret string `json:"-"`
+		Cache  string `json:"cache" hash:"ignore"`
+	}
+	one, err = Hash(Ignored{Name: "foo", Secret: "a", Cache: "a"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(Ignored{Name: "foo", Secret: "b", Cache: "b"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("json:\"-\" fields should still be hashed")
+	}
+	three, err := Hash(Ignored{Name: "foo", Secret: "a", Cache: "b"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != three {
+		t.Fatal("ignored fields should not be hashed")
+	}
+}
+
+func TestHash_useGobEncoder(t *testing.T) {
+	type Account struct {
+		Balance *big.Int
+	}
+
+	opts := &HashOptions{UseGobEncoder: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// big.Int keeps its state unexported, so it hashes as a constant
+		{Account{big.NewInt(1)}, Account{big.NewInt(2)}, nil, true},
+		{Account{big.NewInt(1)}, Account{big.NewInt(2)}, opts, false},
+		{Account{big.NewInt(1)}, Account{big.NewInt(1)}, opts, true},
+		{Account{big.NewInt(-1)}, Account{big.NewInt(1)}, opts, false},
+		{Account{nil}, Account{big.NewInt(0)}, opts, false},
+		{*big.NewInt(5), big.NewInt(5), opts, false},
+		{&[]big.Int{*big.NewInt(5)}[0], big.NewInt(5), opts, true},
+
+		// Values within interfaces are encoded too
+		{[]interface{}{big.NewInt(1)}, []interface{}{big.NewInt(2)}, opts, false},
+		{[]interface{}{big.NewInt(1)}, []interface{}{big.NewInt(1)}, opts, true},
+		{
+			map[string]interface{}{"a": big.NewInt(1)},
+			map[string]interface{}{"a": big.NewInt(2)},
+			opts,
+			false,
+		},
+		{
+			struct{ Balance interface{} }{big.NewInt(1)},
+			struct{ Balance interface{} }{big.NewInt(2)},
+			opts,
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_treatNilMapValuesAsMissing(t *testing.T) {
+	n := 1
+	opts := &HashOptions{TreatNilMapValuesAsMissing: true}
+	zeroNil := &HashOptions{TreatNilMapValuesAsMissing: true, ZeroNil: true}
+
+	var decoded, empty map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"a": 1, "k": null}`), &decoded); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := json.Unmarshal([]byte(`{"a": 1}`), &empty); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{map[string]*int{"k": nil}, map[string]*int{}, opts, true},
+		{map[string]*int{"k": nil}, map[string]*int{}, nil, false},
+		{map[string]*int{"k": nil}, map[string]*int{}, zeroNil, true},
+		{map[string]*int{"k": &n}, map[string]*int{}, opts, false},
+		{map[string][]int{"k": nil}, map[string][]int{}, opts, true},
+		{map[string][]int{"k": {}}, map[string][]int{}, opts, false},
+		{decoded, empty, opts, true},
+		{decoded, empty, nil, false},
+
+		// Only map entries are affected
+		{[]*int{nil}, []*int{}, opts, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_timesAsInstants(t *testing.T) {
+	now := time.Now()
+	stripped := now.Round(0)
+	tokyo := now.In(time.FixedZone("JST", 9*60*60))
+
+	type Event struct {
+		At time.Time
+	}
+
+	opts := &HashOptions{TimesAsInstants: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// The monotonic clock reading never matters
+		{now, stripped, nil, true},
+		{[]time.Time{now}, []time.Time{stripped}, nil, true},
+
+		{now, tokyo, nil, false},
+		{now, tokyo, opts, true},
+		{now, now.Add(time.Nanosecond), opts, false},
+		{[]time.Time{now, stripped}, []time.Time{tokyo, now.UTC()}, opts, true},
+		{[]time.Time{now, stripped}, []time.Time{tokyo, now.UTC()}, nil, false},
+		{map[string]time.Time{"a": now}, map[string]time.Time{"a": tokyo}, opts, true},
+		{map[time.Time]int{now: 1}, map[time.Time]int{tokyo: 1}, opts, true},
+		{[]interface{}{&now}, []interface{}{tokyo}, opts, true},
+		{[]Event{{now}}, []Event{{tokyo}}, opts, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_fieldBoundaries(t *testing.T) {
+	type Pair struct {
+		A, B string
+	}
+
+	type Bytes struct {
+		A, B []byte
+	}
+
+	type Nested struct {
+		A []string
+		B string
+	}
+
+	cases := []struct {
+		One, Two interface{}
+	}{
+		{Pair{"ab", "c"}, Pair{"a", "bc"}},
+		{Pair{"abc", ""}, Pair{"", "abc"}},
+		{Pair{"a", "b"}, Pair{"b", "a"}},
+		{Bytes{[]byte{1, 2}, []byte{3}}, Bytes{[]byte{1}, []byte{2, 3}}},
+		{Nested{[]string{"a", "b"}, "c"}, Nested{[]string{"a"}, "bc"}},
+		{Nested{[]string{"a"}, "b"}, Nested{[]string{"a", "b"}, ""}},
+	}
+
+	for _, format := range []Format{FormatV1, FormatV2} {
+		for i, tc := range cases {
+			one, err := Hash(tc.One, format, nil)
+			if err != nil {
+				t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+			}
+			two, err := Hash(tc.Two, format, nil)
+			if err != nil {
+				t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+			}
+
+			if one == two {
+				t.Fatalf("%d: expected different hashes:\n\n%#v\n\n%#v", i, tc.One, tc.Two)
+			}
+		}
+	}
+}
+
+func TestHash_fieldsAddedRemoved(t *testing.T) {
+	v1 := struct {
+		Name string
+	}{"a"}
+	v2 := struct {
+		Name string
+		Port int
+	}{Name: "a"}
+	v3 := struct {
+		Name string
+		Port int
+		Tags []string
+	}{Name: "a"}
+	renamed := struct {
+		Name string
+		Host int
+	}{Name: "a"}
+	empty := struct {
+		Name  string
+		Extra struct{}
+	}{Name: "a"}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// Adding and removing a zero field changes the hash
+		{v1, v2, nil, false},
+		{v2, v1, nil, false},
+		{v2, v3, nil, false},
+		{v1, v3, nil, false},
+		{v2, renamed, nil, false},
+		{v1, empty, nil, false},
+
+		// Unless zero fields are ignored
+		{v1, v2, &HashOptions{IgnoreZeroValue: true}, true},
+		{v1, v3, &HashOptions{IgnoreZeroValue: true}, true},
+	}
+
+	for _, format := range []Format{FormatV1, FormatV2} {
+		for i, tc := range cases {
+			one, err := Hash(tc.One, format, tc.Opts)
+			if err != nil {
+				t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+			}
+			two, err := Hash(tc.Two, format, tc.Opts)
+			if err != nil {
+				t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+			}
+
+			// Compare
+			if (one == two) != tc.Match {
+				t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+			}
+		}
+	}
+}
+
+// testValuer is stored as its upper-cased name.
+type testValuer struct {
+	Name string
+	fail bool
+}
+
+func (v testValuer) Value() (driver.Value, error) {
+	if v.fail {
+		return nil, errors.New("failed")
+	}
+
+	return strings.ToUpper(v.Name), nil
+}
+
+func TestHash_useValuer(t *testing.T) {
+	now := time.Now()
+	tokyo := now.In(time.FixedZone("JST", 9*60*60))
+
+	type Entity struct {
+		ID        int
+		Owner     testValuer
+		DeletedAt sql.NullTime
+	}
+
+	opts := &HashOptions{UseValuer: true}
+	instants := &HashOptions{UseValuer: true, TimesAsInstants: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{testValuer{Name: "foo"}, testValuer{Name: "FOO"}, nil, false},
+		{testValuer{Name: "foo"}, testValuer{Name: "FOO"}, opts, true},
+		{testValuer{Name: "foo"}, "FOO", opts, true},
+		{&testValuer{Name: "foo"}, testValuer{Name: "FOO"}, opts, true},
+
+		// NULL ignores the rest of the value but isn't zero
+		{sql.NullTime{Time: now}, sql.NullTime{}, nil, false},
+		{sql.NullTime{Time: now}, sql.NullTime{}, opts, true},
+		{sql.NullInt64{}, sql.NullInt64{Valid: true}, opts, false},
+		{sql.NullInt64{Int64: 42, Valid: true}, int64(42), opts, true},
+
+		// The stored value is hashed with the other options
+		{sql.NullTime{Time: now, Valid: true}, sql.NullTime{Time: tokyo, Valid: true}, opts, false},
+		{sql.NullTime{Time: now, Valid: true}, sql.NullTime{Time: tokyo, Valid: true}, instants, true},
+		{
+			Entity{1, testValuer{Name: "foo"}, sql.NullTime{Time: now, Valid: true}},
+			Entity{1, testValuer{Name: "Foo"}, sql.NullTime{Time: tokyo, Valid: true}},
+			instants,
+			true,
+		},
+		{
+			[]Entity{{ID: 1, DeletedAt: sql.NullTime{Time: now}}},
+			[]Entity{{ID: 1}},
+			opts,
+			true,
+		},
+		{
+			[]Entity{{ID: 1, DeletedAt: sql.NullTime{Time: now, Valid: true}}},
+			[]Entity{{ID: 1}},
+			opts,
+			false,
+		},
+
+		// Values within interfaces are hashed by their stored form too
+		{[]interface{}{sql.NullTime{}}, []interface{}{sql.NullString{}}, opts, true},
+		{[]interface{}{sql.NullTime{Time: now}}, []interface{}{sql.NullTime{}}, opts, true},
+		{[]interface{}{sql.NullTime{}}, []interface{}{time.Time{}}, opts, false},
+		{
+			map[string]interface{}{"deleted": sql.NullTime{Time: now}},
+			map[string]interface{}{"deleted": sql.NullInt64{Int64: 1}},
+			opts,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Errors from Value are returned
+	if _, err := Hash(testValuer{fail: true}, testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_mixedInterfaceMaps(t *testing.T) {
+	type doc = map[string]interface{}
+
+	// Documents that are easily confused, which must all differ
+	docs := []doc{
+		{},
+		{"a": nil},
+		{"a": 0},
+		{"a": uint(0)},
+		{"a": 0.0},
+		{"a": false},
+		{"a": ""},
+		{"a": 1},
+		{"a": uint(1)},
+		{"a": 1.0},
+		{"a": true},
+		{"a": "1"},
+		{"a": []interface{}{}},
+		{"a": []interface{}{nil}},
+		{"a": []interface{}{0}},
+		{"a": []interface{}{1, "x"}},
+		{"a": []interface{}{"x", 1}},
+		{"a": doc{}},
+		{"a": doc{"b": nil}},
+		{"a": doc{"b": 1}},
+		{"a": doc{}, "b": 1},
+		{"a": doc{"0": 1}},
+		{"a": "b"},
+		{"b": "a"},
+		{"a": 1, "b": 1},
+		{"a": 2, "b": 2},
+	}
+
+	opts := &HashOptions{ScalarCategories: true}
+	seen := make(map[uint64]int)
+	for i, d := range docs {
+		h, err := Hash(d, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", d, err)
+		}
+
+		if j, ok := seen[h]; ok {
+			t.Fatalf("%d and %d collide:\n\n%#v\n\n%#v", j, i, docs[j], d)
+		}
+		seen[h] = i
+
+		if err := AssertConsistent(testFormat, opts, d); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Without categories, nil is still hashed as zero
+	one, err := Hash(doc{"a": nil}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(doc{"a": 0}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("expected nil to hash as zero by default")
+	}
+
+	// Platform sized integers still hash as their 64-bit equivalents
+	one, err = Hash(doc{"a": 1, "b": []interface{}{uint(2)}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err = Hash(doc{"a": int64(1), "b": []interface{}{uint64(2)}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("expected equal documents to hash the same")
+	}
+}
+
+func TestHash_merkle(t *testing.T) {
+	opts := &HashOptions{Merkle: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{[]int{1, 2, 3}, []int{1, 2, 3}, opts, true},
+		{[]int{1, 2, 3}, []int{3, 2, 1}, opts, false},
+		{[]int{1, 2, 3}, []int{1, 2, 3}, nil, true},
+		{[]int{1}, 1, opts, false},
+		{[]int{1, 2}, []int{1, 2, 0}, opts, false},
+		{[][]int{{1}}, []int{1}, opts, false},
+		{[]int{}, []int(nil), opts, true},
+		{[]string{"a", "b"}, []string{"b", "a"}, &HashOptions{Merkle: true, SlicesAsSets: true}, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// The tree is used, so the result differs from folding in order
+	one, err := Hash([]int{1, 2, 3}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash([]int{1, 2, 3}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("expected Merkle to change the hash")
+	}
+}
+
+func TestMerkleHash(t *testing.T) {
+	for n := 0; n < 10; n++ {
+		v := make([]string, n)
+		for i := range v {
+			v[i] = fmt.Sprintf("elem %d", i)
+		}
+
+		r, err := MerkleHash(v, testFormat, nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		expected, err := Hash(v, testFormat, &HashOptions{Merkle: true})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if r.Root() != expected {
+			t.Fatalf("%d: root %d doesn't match hash %d", n, r.Root(), expected)
+		}
+
+		// Updating any element matches hashing the changed slice
+		for i := range v {
+			v[i] = fmt.Sprintf("changed %d", i)
+			root, err := r.Update(i, v[i])
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			expected, err := Hash(v, testFormat, &HashOptions{Merkle: true})
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if root != expected || r.Root() != expected {
+				t.Fatalf("%d: root %d after updating %d doesn't match hash %d", n, root, i, expected)
+			}
+		}
+	}
+
+	// Pointers to slices are followed
+	v := []int{1, 2, 3}
+	r, err := MerkleHash(&v, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if r.Len() != 3 {
+		t.Fatalf("bad: %d", r.Len())
+	}
+
+	if _, err := r.Update(3, 4); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := MerkleHash(42, testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMerkleHash_options(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+
+	loop := &Node{Name: "loop"}
+	loop.Next = loop
+	shared := &Node{Name: "shared"}
+	self := make([]interface{}, 7)
+	self[0] = (*int)(nil)
+	self[1] = io.Reader(nil)
+	self[2] = testPluginA{"a": "b"}
+	self[3] = shared
+	self[4] = shared
+	self[5] = loop
+	self[6] = self
+
+	cases := []*HashOptions{
+		{},
+		{TypeNames: map[reflect.Type]string{}},
+		{TypedNilInterfaces: true},
+		{SharePointers: true},
+		{IncludeNilMarker: true},
+		{
+			TypeNames:          map[reflect.Type]string{reflect.TypeOf(testPluginA(nil)): "a"},
+			TypedNilInterfaces: true,
+			SharePointers:      true,
+		},
+	}
+
+	for i, opts := range cases {
+		r, err := MerkleHash(self, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		merkleOpts := *opts
+		merkleOpts.Merkle = true
+		expected, err := Hash(self, testFormat, &merkleOpts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if r.Root() != expected {
+			t.Fatalf("%d: root %d doesn't match hash %d", i, r.Root(), expected)
+		}
+
+		// Updating an element with itself keeps its interface layer
+		root, err := r.Update(0, self[0])
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if root != expected {
+			t.Fatalf("%d: root %d after update doesn't match hash %d", i, root, expected)
+		}
+	}
+}
+
+func TestMerkleHash_sliceOptions(t *testing.T) {
+	type Names []string
+	upper := func(v interface{}) interface{} { return strings.ToUpper(v.(string)) }
+
+	// These match Hash
+	supported := []struct {
+		V    interface{}
+		Opts *HashOptions
+	}{
+		{[]string(nil), &HashOptions{IncludeNilMarker: true}},
+		{[]string{}, &HashOptions{IncludeNilMarker: true}},
+		{[]string(nil), &HashOptions{DeepEqualSemantics: true}},
+		{[]string{"a", "b"}, &HashOptions{Transformers: map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(""): upper,
+		}}},
+		{[]string{"a", "b"}, &HashOptions{Marshaler: func(v interface{}) ([]byte, bool, error) {
+			s, ok := v.(string)
+			return []byte(s), ok, nil
+		}}},
+	}
+	for i, tc := range supported {
+		r, err := MerkleHash(tc.V, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		opts := *tc.Opts
+		opts.Merkle = true
+		expected, err := Hash(tc.V, testFormat, &opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if r.Root() != expected {
+			t.Fatalf("%d: root %d doesn't match hash %d", i, r.Root(), expected)
+		}
+	}
+
+	// These can't match Hash, so they're refused
+	unsupported := []struct {
+		V    interface{}
+		Opts *HashOptions
+	}{
+		{[]string{"a", "b", "a"}, &HashOptions{SliceDedup: true}},
+		{[]string{"a", "b"}, &HashOptions{SlicesAsSets: true}},
+		{[]float64{1}, &HashOptions{SkipNaN: true}},
+		{[]string{"a"}, &HashOptions{StringifyAll: true}},
+		{[]string{"a"}, &HashOptions{ResetPolicy: ResetNever}},
+		{Names{"a", "b"}, &HashOptions{Transformers: map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(Names(nil)): func(v interface{}) interface{} { return len(v.(Names)) },
+		}}},
+		{&Names{"a", "b"}, &HashOptions{Transformers: map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(&Names{}): func(v interface{}) interface{} { return 0 },
+		}}},
+		{Names{"a", "b"}, &HashOptions{Marshaler: func(v interface{}) ([]byte, bool, error) {
+			_, ok := v.(Names)
+			return []byte("names"), ok, nil
+		}}},
+		{testNamesHashMarshaler{"a"}, &HashOptions{UseHashMarshaler: true}},
+	}
+	for i, tc := range unsupported {
+		if _, err := MerkleHash(tc.V, testFormat, tc.Opts); err == nil {
+			t.Fatalf("%d: expected error", i)
+		}
+	}
+}
+
+// testNamesHashMarshaler is a slice with its own hash form.
+type testNamesHashMarshaler []string
+
+func (n testNamesHashMarshaler) MarshalHash() ([]byte, error) {
+	return []byte(strings.Join(n, ",")), nil
+}
+
+func TestHash_nilPointersDistinct(t *testing.T) {
+	type C struct {
+		X int
+	}
+	type B struct {
+		C *C
+	}
+	type A struct {
+		B *B
+	}
+
+	zero := 0
+	zeroPtr := &zero
+	var nilC *C
+	opts := &HashOptions{NilPointersDistinct: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{(*int)(nil), &zero, nil, true},
+		{(*int)(nil), &zero, opts, false},
+		{(*int)(nil), 0, opts, false},
+		{(*int)(nil), (*string)(nil), opts, true},
+		{&A{&B{}}, &A{&B{&C{}}}, &HashOptions{ZeroNil: true}, true},
+		{&A{&B{}}, &A{&B{&C{}}}, &HashOptions{ZeroNil: true, NilPointersDistinct: true}, false},
+		{&A{&B{}}, &A{&B{&C{}}}, opts, false},
+		{&A{}, &A{&B{}}, opts, false},
+		{(*A)(nil), &A{}, opts, false},
+		{&A{&B{}}, &A{&B{}}, opts, true},
+		{&A{&B{&C{}}}, &A{&B{&C{}}}, opts, true},
+		{[]*C{nil, {}}, []*C{{}, nil}, opts, false},
+		{map[string]*C{"a": nil}, map[string]*C{"a": {}}, opts, false},
+		{[]interface{}{nilC}, []interface{}{&C{}}, opts, false},
+		{&struct{ P **int }{new(*int)}, &struct{ P **int }{&zeroPtr}, opts, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_preHash(t *testing.T) {
+	type Secret string
+	type User struct {
+		Name     string
+		Password Secret
+	}
+
+	redact := func(v interface{}) (interface{}, error) {
+		u, ok := v.(User)
+		if !ok {
+			return nil, errors.New("not a user")
+		}
+
+		u.Password = "redacted"
+		return u, nil
+	}
+
+	opts := &HashOptions{PreHash: redact}
+	one, err := Hash(User{"foo", "hunter2"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(User{"foo", "secret"}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("expected redacted values to hash the same")
+	}
+
+	// The result is what is hashed
+	three, err := Hash(User{"foo", "redacted"}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != three {
+		t.Fatal("expected the result of PreHash to be hashed")
+	}
+
+	// Transformers apply to the result
+	var calls int
+	opts.Transformers = map[reflect.Type]func(interface{}) interface{}{
+		reflect.TypeOf(Secret("")): func(v interface{}) interface{} {
+			if v.(Secret) != "redacted" {
+				t.Fatalf("bad: %#v", v)
+			}
+
+			calls++
+			return v
+		},
+	}
+	if _, err := Hash(User{"foo", "hunter2"}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if calls != 1 {
+		t.Fatalf("bad: %d", calls)
+	}
+
+	// Errors are returned
+	if _, err := Hash("foo", testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_arrayLengths(t *testing.T) {
+	type Buffer struct {
+		Data [3]int
+	}
+
+	opts := &HashOptions{ArrayLengths: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{[2]int{1, 2}, [3]int{1, 2, 3}, nil, false},
+		{[2]int{1, 2}, [3]int{1, 2, 3}, opts, false},
+		{[2]int{1, 2}, [3]int{1, 2, 0}, opts, false},
+		{[0]int{}, [1]int{}, opts, false},
+		{[2]int{1, 2}, []int{1, 2}, nil, true},
+		{[2]int{1, 2}, []int{1, 2}, opts, false},
+		{[0]int{}, []int{}, opts, false},
+		{[2]int{1, 2}, [2]int{1, 2}, opts, true},
+		{[2]int{1, 2}, [2]int{2, 1}, opts, false},
+		{[][2]int{{1, 2}, {3, 4}}, [][]int{{1, 2}, {3, 4}}, opts, false},
+		{Buffer{[3]int{1, 2}}, Buffer{[3]int{1, 2}}, opts, true},
+		{Buffer{[3]int{1, 2}}, Buffer{[3]int{1, 2, 3}}, opts, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_deterministic(t *testing.T) {
+	type Config struct {
+		Ratio   float64
+		Created time.Time
+		Tags    map[string]int
+	}
+	type Formatted struct {
+		Tags map[string][]int `hash:"gostring"`
+		Refs []*int           `hash:"gostring"`
+	}
+
+	utc := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts := &HashOptions{Deterministic: true}
+
+	// These are allowed
+	allowed := []struct {
+		V    interface{}
+		Opts *HashOptions
+	}{
+		{Config{Ratio: 1.5, Created: utc, Tags: map[string]int{"a": 1, "b": 2}}, opts},
+		{utc.In(time.FixedZone("JST", 9*60*60)), opts},
+		{time.Now(), &HashOptions{Deterministic: true, TimesAsInstants: true}},
+		{[]float64{1, math.NaN()}, &HashOptions{Deterministic: true, SkipNaN: true}},
+		{math.Inf(1), opts},
+		{[]interface{}{1, "a", []int{2}}, &HashOptions{Deterministic: true, StringifyAll: true}},
+		{&[]string{"a"}, &HashOptions{Deterministic: true, StringifyAll: true}},
+		{&Formatted{Tags: map[string][]int{"a": {1}}}, opts},
+	}
+	for i, tc := range allowed {
+		if _, err := Hash(tc.V, testFormat, tc.Opts); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+	}
+
+	// These are refused, but only with Deterministic
+	refused := []struct {
+		V      interface{}
+		Opts   *HashOptions
+		Reason string
+		Path   string
+	}{
+		{math.NaN(), nil, "NaN", ""},
+		{Config{Ratio: math.NaN()}, nil, "NaN", "Ratio"},
+		{[]complex64{complex(float32(math.NaN()), 0)}, nil, "NaN", "[0]"},
+		{Config{Created: time.Now()}, nil, "local time", "Created"},
+		{map[string]func(){"a": func() {}}, &HashOptions{FuncsByPointer: true}, "func", "[a]"},
+		{42, &HashOptions{Hasher: NewMaphashHasher()}, "maphash hasher", ""},
+		{[]*int{new(int)}, &HashOptions{StringifyAll: true}, "formatted pointer", ""},
+		{map[string]func(){"a": func() {}}, &HashOptions{StringifyAll: true}, "formatted pointer", ""},
+		{&Formatted{Refs: []*int{new(int)}}, nil, "formatted pointer", "Refs"},
+		{[]testGoStringer{{ID: 1}}, &HashOptions{UseGoStringer: true}, "GoString", "[0]"},
+	}
+	for i, tc := range refused {
+		var o HashOptions
+		if tc.Opts != nil {
+			o = *tc.Opts
+		}
+		if _, err := Hash(tc.V, testFormat, &o); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		o.Deterministic = true
+		_, err := Hash(tc.V, testFormat, &o)
+		if err == nil {
+			t.Fatalf("%d: expected error", i)
+		}
+
+		en, ok := err.(*ErrNondeterministic)
+		if !ok {
+			t.Fatalf("%d: bad error: %s", i, err)
+		}
+		if en.Reason != tc.Reason || en.Path != tc.Path {
+			t.Fatalf("%d: bad: %#v", i, en)
+		}
+	}
+}
+
+func TestHash_precisionTag(t *testing.T) {
+	type Order struct {
+		Price  float64 `hash:"precision=2"`
+		Ratio  float64 `hash:"precision=6"`
+		Exact  float64
+		Prices []float64 `hash:"precision=2"`
+	}
+
+	a, b := 0.1, 0.2
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{Order{Price: 9.99}, Order{Price: 9.991}, nil, true},
+		{Order{Price: 9.99}, Order{Price: 9.98}, nil, false},
+		{Order{Ratio: 0.123456}, Order{Ratio: 0.1234561}, nil, true},
+		{Order{Ratio: 0.123456}, Order{Ratio: 0.123457}, nil, false},
+		{Order{Ratio: a + b}, Order{Ratio: 0.3}, nil, true},
+		{Order{Exact: a + b}, Order{Exact: 0.3}, nil, false},
+		{Order{Prices: []float64{1.001, 2}}, Order{Prices: []float64{1, 2.004}}, nil, true},
+
+		// The tag takes precedence over FloatPrecision for its field only
+		{Order{Price: 9.99}, Order{Price: 9.991}, &HashOptions{FloatPrecision: 6}, true},
+		{Order{Exact: 9.99}, Order{Exact: 9.991}, &HashOptions{FloatPrecision: 6}, false},
+		{Order{Exact: 9.99}, Order{Exact: 9.991}, &HashOptions{FloatPrecision: 1}, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Rounding normalizes NaN, which is then deterministic
+	opts := &HashOptions{Deterministic: true}
+	if _, err := Hash(Order{Price: math.NaN()}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := Hash(Order{Exact: math.NaN()}, testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+
+	type Bad struct {
+		Price float64 `hash:"precision=two"`
+	}
+	if _, err := Hash(Bad{}, testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	} else if _, ok := err.(*ErrInvalidTag); !ok {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestHash_includeNilMarker(t *testing.T) {
+	type S struct {
+		Name string
+	}
+
+	// Each nil, alongside the zero value that it otherwise hashes like
+	zero := 0
+	cases := []struct {
+		Nil, Zero interface{}
+	}{
+		{nil, 0},
+		{(*int)(nil), &zero},
+		{(*S)(nil), 0},
+		{[]int(nil), []int{}},
+		{map[string]int(nil), map[string]int{}},
+		{(func())(nil), uint64(0)},
+		{[]interface{}{nil}, []interface{}{0}},
+		{[]interface{}{(*int)(nil)}, []interface{}{&zero}},
+		{map[string]interface{}{"a": nil}, map[string]interface{}{"a": 0}},
+		{struct{ L []int }{}, struct{ L []int }{[]int{}}},
+		{struct{ M map[int]int }{}, struct{ M map[int]int }{map[int]int{}}},
+	}
+
+	opts := &HashOptions{IncludeNilMarker: true, FuncsByPointer: true}
+	var nilHash uint64
+	for i, tc := range cases {
+		// Without the option, nil hashes like the zero value
+		one, err := Hash(tc.Nil, testFormat, &HashOptions{FuncsByPointer: true})
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		two, err := Hash(tc.Zero, testFormat, &HashOptions{FuncsByPointer: true})
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if one != two {
+			t.Fatalf("%d: expected nil to hash like zero without the option", i)
+		}
+
+		one, err = Hash(tc.Nil, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		two, err = Hash(tc.Zero, testFormat, opts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if one == two {
+			t.Fatalf("%d: expected nil to differ from zero:\n\n%#v\n\n%#v", i, tc.Nil, tc.Zero)
+		}
+
+		// Every nil given to Hash itself is the same marker
+		if i == 0 {
+			nilHash = one
+		} else if i < 6 && one != nilHash {
+			t.Fatalf("%d: expected every nil to hash the same", i)
+		}
+	}
+
+	// The marker takes precedence over ZeroNil
+	one, err := Hash((*S)(nil), testFormat, &HashOptions{IncludeNilMarker: true, ZeroNil: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(&S{}, testFormat, &HashOptions{IncludeNilMarker: true, ZeroNil: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one == two {
+		t.Fatal("expected nil to differ from zero with ZeroNil")
+	}
+}
+
+func TestHash_orderedRanger(t *testing.T) {
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{
+			newTestOrderedMap("a", 1, "b", 2),
+			newTestOrderedMap("a", 1, "b", 2),
+			true,
+		},
+		{
+			newTestOrderedMap("a", 1, "b", 2),
+			newTestOrderedMap("b", 2, "a", 1),
+			false,
+		},
+		{
+			newTestOrderedMap("a", 1, "b", 2),
+			newTestOrderedMap("a", 2, "b", 1),
+			false,
+		},
+		{
+			newTestOrderedMap("a", 1),
+			newTestOrderedMap("a", 1, "b", 2),
+			false,
+		},
+		{
+			newTestOrderedMap("a", 1, "b", 2),
+			map[string]interface{}{"a": 1, "b": 2},
+			false,
+		},
+		{
+			struct{ M *testOrderedMap }{newTestOrderedMap("a", []int{1})},
+			struct{ M *testOrderedMap }{newTestOrderedMap("a", []int{1})},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, nil)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Errors stop ranging and are returned
+	if _, err := Hash(newTestOrderedMap("a", func() {}), testFormat, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_fastMapInterfaces(t *testing.T) {
+	// Enough entries to be hashed in parallel
+	v := make(map[string]interface{})
+	for i := 0; i < 2*parallelMinKeys; i++ {
+		var e interface{}
+		switch i % 9 {
+		case 0:
+			e = nil
+		case 1:
+			e = big.NewInt(int64(i))
+		case 2:
+			e = sql.NullTime{}
+		case 3:
+			e = testHashMarshaler{ID: "a", Cache: map[string]int{"i": i}}
+		case 4:
+			e = testCanonical{Tags: []string{"b", "a"}}
+		case 5:
+			e = testGoStringer{ID: 1, Cache: fmt.Sprint(i)}
+		case 6:
+			e = io.Reader(nil)
+		case 7:
+			e = testPluginA{"n": "x"}
+		default:
+			e = i
+		}
+		v[fmt.Sprint(i)] = e
+	}
+
+	opts := []*HashOptions{
+		{},
+		{TypedNilInterfaces: true},
+		{UseGobEncoder: true},
+		{UseValuer: true},
+		{UseHashMarshaler: true},
+		{UseCanonical: true},
+		{UseGoStringer: true},
+		{IncludeNilMarker: true},
+		{TypeNames: map[reflect.Type]string{reflect.TypeOf(testPluginA(nil)): "a"}},
+	}
+
+	for i, o := range opts {
+		fast, err := Hash(v, testFormat, o)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		// Pruning nothing forces every entry to be reflected over
+		slowOpts := *o
+		slowOpts.Prune = func(string) bool { return false }
+		slow, err := Hash(v, testFormat, &slowOpts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		parallelOpts := *o
+		parallelOpts.Parallel = true
+		parallel, err := Hash(v, testFormat, &parallelOpts)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		if fast != slow || fast != parallel {
+			t.Fatalf("%d: fast %d, slow %d and parallel %d differ", i, fast, slow, parallel)
+		}
+	}
+}
+
+func TestHash_fastMaps(t *testing.T) {
+	type Labels map[string]string
+
+	values := []interface{}{
+		map[string]string{},
+		map[string]string{"app": "web", "env": "prod"},
+		Labels{"app": "web", "env": "prod"},
+		map[string]int{"hits": 42, "misses": -1},
+		map[string]interface{}{
+			"name":   "foo",
+			"count":  3,
+			"tags":   []interface{}{"a", 1.5, nil},
+			"nested": map[string]interface{}{"labels": map[string]string{"a": "b"}},
+		},
+		struct{ Labels map[string]string }{map[string]string{"a": "b"}},
+		struct {
+			Set map[string]int `hash:"set"`
+		}{map[string]int{"a": 1}},
+	}
+
+	opts := []*HashOptions{
+		{},
+		{ScalarCategories: true},
+		{CanonicalNumbers: true},
+		{ByteOrder: binary.BigEndian},
+		{ZeroNil: true, IncludeNilMarker: true},
+	}
+
+	for i, v := range values {
+		for j, o := range opts {
+			fast, err := Hash(v, testFormat, o)
+			if err != nil {
+				t.Fatalf("%d/%d: err: %s", i, j, err)
+			}
+
+			// Pruning nothing forces every entry to be reflected over
+			slowOpts := *o
+			slowOpts.Prune = func(string) bool { return false }
+			slow, err := Hash(v, testFormat, &slowOpts)
+			if err != nil {
+				t.Fatalf("%d/%d: err: %s", i, j, err)
+			}
+
+			if fast != slow {
+				t.Fatalf("%d/%d: fast path differs for %#v", i, j, v)
+			}
+		}
+	}
+
+	// Transformers for strings are still applied
+	upper := &HashOptions{
+		Transformers: map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(""): func(v interface{}) interface{} {
+				return strings.ToUpper(v.(string))
+			},
+		},
+	}
+	one, err := Hash(map[string]string{"a": "b"}, testFormat, upper)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(map[string]string{"A": "B"}, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("expected transformer to be applied")
+	}
+
+	// Errors in interface values are returned with their path
+	_, err = Hash(map[string]interface{}{"f": func() {}}, testFormat, nil)
+	if euk, ok := err.(*ErrUnsupportedKind); !ok || euk.Path != "[f]" {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func BenchmarkHash_labelMap(b *testing.B) {
+	labels := make(map[string]string, 100)
+	for i := 0; i < 100; i++ {
+		labels[fmt.Sprintf("label-%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Hash(labels, testFormat, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// A transformer for ints, which the map doesn't hold, forces every
+	// entry to be reflected over
+	b.Run("reflect", func(b *testing.B) {
+		opts := &HashOptions{
+			Transformers: map[reflect.Type]func(interface{}) interface{}{
+				reflect.TypeOf(0): func(v interface{}) interface{} { return v },
+			},
+		}
+		for i := 0; i < b.N; i++ {
+			if _, err := Hash(labels, testFormat, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestHash_dedup(t *testing.T) {
+	type Modes struct {
+		Set      []string `hash:"set"`
+		Multiset []string `hash:"multiset"`
+		Dedup    []string `hash:"dedup"`
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// Order matters only for dedup
+		{Modes{Set: []string{"a", "b"}}, Modes{Set: []string{"b", "a"}}, nil, true},
+		{Modes{Multiset: []string{"a", "b"}}, Modes{Multiset: []string{"b", "a"}}, nil, true},
+		{Modes{Dedup: []string{"a", "b"}}, Modes{Dedup: []string{"b", "a"}}, nil, false},
+
+		// Duplicates matter only for multiset
+		{Modes{Set: []string{"a", "b", "a"}}, Modes{Set: []string{"a", "b"}}, nil, true},
+		{Modes{Multiset: []string{"a", "b", "a"}}, Modes{Multiset: []string{"a", "b"}}, nil, false},
+		{Modes{Dedup: []string{"a", "b", "a"}}, Modes{Dedup: []string{"a", "b"}}, nil, true},
+		{Modes{Dedup: []string{"a", "a", "b", "b"}}, Modes{Dedup: []string{"a", "b"}}, nil, true},
+
+		// The first occurrence is kept
+		{Modes{Dedup: []string{"b", "a", "b"}}, Modes{Dedup: []string{"b", "a"}}, nil, true},
+		{Modes{Dedup: []string{"b", "a", "b"}}, Modes{Dedup: []string{"a", "b"}}, nil, false},
+
+		// Every untagged slice is deduplicated with SliceDedup
+		{[]string{"a", "b", "a"}, []string{"a", "b"}, &HashOptions{SliceDedup: true}, true},
+		{[]string{"a", "b", "a"}, []string{"b", "a"}, &HashOptions{SliceDedup: true}, false},
+
+		// Tags and SlicesAsSets take precedence over SliceDedup
+		{Modes{Multiset: []string{"a", "a"}}, Modes{Multiset: []string{"a"}}, &HashOptions{SliceDedup: true}, false},
+		{[]string{"a", "b"}, []string{"b", "a"}, &HashOptions{SliceDedup: true, SlicesAsSets: true}, true},
+
+		// The tag takes precedence over SlicesAsSets
+		{Modes{Dedup: []string{"a", "b", "a"}}, Modes{Dedup: []string{"a", "b"}}, &HashOptions{SlicesAsSets: true}, true},
+		{Modes{Dedup: []string{"a", "b"}}, Modes{Dedup: []string{"b", "a"}}, &HashOptions{SlicesAsSets: true}, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_netBytes(t *testing.T) {
+	type Interface struct {
+		MAC net.HardwareAddr
+		IP  net.IP
+	}
+
+	mac := net.HardwareAddr{0x0a, 0x00, 0x00, 0x01}
+	ip := net.IPv4(10, 0, 0, 1)
+	named := &HashOptions{NamedTypeIdentity: true}
+	marshaler := &HashOptions{Marshaler: func(v interface{}) ([]byte, bool, error) {
+		if d, ok := v.(time.Duration); ok {
+			return []byte(d.String()), true, nil
+		}
+		return nil, false, nil
+	}}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{ip, ip.To4(), nil, true},
+		{ip, net.ParseIP("10.0.0.1"), nil, true},
+		{ip, net.IPv4(10, 0, 0, 2), nil, false},
+		{net.ParseIP("::1"), net.ParseIP("::2"), nil, false},
+		{ip, []byte(ip), nil, false},
+		{mac, []byte(mac), nil, false},
+		{ip.To4(), mac, nil, true},
+		{ip.To4(), mac, named, false},
+		{net.IPMask(ip.To4()), ip.To4(), named, false},
+		{Interface{mac, ip}, Interface{mac, ip.To4()}, named, true},
+		{Interface{MAC: mac}, Interface{IP: net.IP(mac)}, named, false},
+		{[]interface{}{mac}, []interface{}{net.IP(mac)}, nil, true},
+		{[]interface{}{mac}, []interface{}{net.IP(mac)}, named, false},
+		{net.IP(nil), net.IP{}, nil, true},
+
+		// A Marshaler that declines them leaves them as they are
+		{ip, ip.To4(), marshaler, true},
+		{Interface{mac, ip}, Interface{mac, ip.To4()}, marshaler, true},
+		{ip, []byte(ip), marshaler, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_includeUnexported(t *testing.T) {
+	type inner struct {
+		id int
+	}
+	type Outer struct {
+		Name  string
+		count int
+		in    inner
+		ptr   *inner
+		mu    sync.Mutex
+	}
+
+	opts := &HashOptions{IncludeUnexported: true, IgnoreSyncPrimitives: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{Outer{Name: "a", count: 1}, Outer{Name: "a", count: 2}, nil, true},
+		{Outer{Name: "a", count: 1}, Outer{Name: "a", count: 2}, opts, false},
+		{Outer{count: 1}, Outer{count: 1}, opts, true},
+		{Outer{in: inner{1}}, Outer{in: inner{2}}, opts, false},
+		{Outer{ptr: &inner{1}}, Outer{ptr: &inner{1}}, opts, true},
+		{Outer{ptr: &inner{1}}, Outer{ptr: &inner{2}}, opts, false},
+		{&Outer{count: 1}, Outer{count: 1}, opts, true},
+		{[]Outer{{count: 1}}, []Outer{{count: 2}}, opts, false},
+		{map[string]inner{"a": {1}}, map[string]inner{"a": {2}}, opts, false},
+		{big.NewInt(1), big.NewInt(2), nil, true},
+		{big.NewInt(1), big.NewInt(2), opts, false},
+		{big.NewInt(-1), big.NewInt(1), opts, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Unexported fields that can't be hashed are errors
+	type withFunc struct {
+		fn func()
+	}
+	if _, err := Hash(withFunc{}, testFormat, opts); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHash_deepEqualSemantics(t *testing.T) {
+	type point struct {
+		x, y int
+	}
+	type Named int
+	type Doc struct {
+		Name   string
+		Tags   []string
+		Meta   map[string]interface{}
+		Origin *point
+		hidden string
+	}
+
+	values := []interface{}{
+		nil,
+		0,
+		uint(0),
+		0.0,
+		false,
+		"",
+		Named(0),
+		[]int(nil),
+		[]int{},
+		[0]int{},
+		[]int{1, 2},
+		[]int{2, 1},
+		[]int{1, 2, 2},
+		[2]int{1, 2},
+		map[string]int(nil),
+		map[string]int{},
+		map[string]int{"a": 1},
+		map[string]interface{}{"a": nil},
+		map[string]interface{}{"a": 0},
+		(*int)(nil),
+		new(int),
+		point{1, 2},
+		point{2, 1},
+		&point{1, 2},
+		Doc{},
+		Doc{Tags: []string{}},
+		Doc{hidden: "x"},
+		Doc{Origin: &point{}},
+		Doc{Meta: map[string]interface{}{}},
+		Doc{Name: "a", Tags: []string{"x", "y"}, Meta: map[string]interface{}{"k": []interface{}{1, "v"}}},
+	}
+
+	opts := &HashOptions{DeepEqualSemantics: true, ZeroNil: true, SlicesAsSets: true}
+	hashes := make([]uint64, len(values))
+	for i, v := range values {
+		h, err := Hash(v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", v, err)
+		}
+		hashes[i] = h
+	}
+
+	// Pointers hash like what they point to, and nil and empty values of
+	// different types may hash the same
+	empty := func(v interface{}) bool {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return rv.Len() == 0
+		}
+
+		return isNil(rv)
+	}
+
+	for i := range values {
+		for j := range values {
+			ti, tj := reflect.TypeOf(values[i]), reflect.TypeOf(values[j])
+			if ti != tj && (empty(values[i]) && empty(values[j]) ||
+				ti != nil && ti.Kind() == reflect.Ptr ||
+				tj != nil && tj.Kind() == reflect.Ptr) {
+				continue
+			}
+
+			if (hashes[i] == hashes[j]) != reflect.DeepEqual(values[i], values[j]) {
+				t.Fatalf("hash equality differs from DeepEqual:\n\n%#v\n\n%#v", values[i], values[j])
+			}
+		}
+	}
+
+	// Equal copies hash the same
+	doc := func() Doc {
+		return Doc{Name: "a", Tags: []string{"x"}, Origin: &point{1, 2}, hidden: "h"}
+	}
+	one, err := Hash(doc(), testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(doc(), testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("expected DeepEqual values to hash the same")
+	}
+
+	// The given options aren't modified
+	if !opts.ZeroNil || !opts.SlicesAsSets || opts.IncludeUnexported {
+		t.Fatalf("options were modified: %#v", opts)
+	}
+}
+
+func TestDeepEqualOptions_allOptions(t *testing.T) {
+	// Options that DeepEqualSemantics sets, and those it clears since they
+	// make different values hash the same
+	set := []string{
+		"IncludeUnexported", "IncludeNilMarker", "NamedTypeIdentity",
+		"ScalarCategories", "ArrayLengths", "IgnoreSyncPrimitives",
+	}
+	cleared := []string{
+		"ZeroNil", "IgnoreZeroValue", "SlicesAsSets", "SliceDedup",
+		"UseStringer", "CanonicalNumbers", "FloatPrecision",
+		"IgnoreEmptyCollections", "TimesAsInstants",
+		"TreatNilMapValuesAsMissing", "CanonicalJSON", "StringifyAll",
+		"UseCanonical", "UseGoStringer", "UseGobEncoder", "UseValuer",
+		"UseHashMarshaler", "UseGetters", "IgnoreUnexportedStructs",
+		"SkipNaN", "CanonicalRawMessages", "IgnoreFuncs", "IgnoreInterfaces",
+		"NumericAsString", "NumbersMatchStrings", "URLsAsStrings",
+	}
+
+	// Options that don't make different values hash the same, or that
+	// are functions given by the caller, which are left alone. A new
+	// option must be added to one of these lists.
+	unaffected := []string{
+		"Hasher", "HasherFactory", "TagName", "SharePointers", "OrderedMaps",
+		"OnIgnore", "IncludeTags", "FuncsByPointer", "ByteOrder", "Logger",
+		"TypedNilInterfaces", "SortFields", "Marshaler", "RawMessageBytes",
+		"FieldName", "DistinctBools", "MaxBytes", "Fallback", "Prune",
+		"Transformers", "ContextTransformers", "Parallel", "ResetPolicy",
+		"NameTag", "Merkle", "NilPointersDistinct", "PreHash",
+		"Deterministic", "DeepEqualSemantics", "BufferSize",
+		"IncludeSliceCap", "HMACKey", "HMACHash", "TypeNames",
+	}
+
+	known := make(map[string]bool)
+	for _, names := range [][]string{set, cleared, unaffected} {
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+	typ := reflect.TypeOf(HashOptions{})
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.PkgPath == "" && !known[f.Name] {
+			t.Errorf("%s isn't known to be handled by DeepEqualSemantics", f.Name)
+		}
+	}
+
+	var in HashOptions
+	for _, name := range cleared {
+		f := reflect.ValueOf(&in).Elem().FieldByName(name)
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int:
+			f.SetInt(1)
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		default:
+			t.Fatalf("%s can't be set", name)
+		}
+	}
+
+	out := reflect.ValueOf(deepEqualOptions(&in)).Elem()
+	for _, name := range set {
+		if !out.FieldByName(name).Bool() {
+			t.Errorf("%s isn't set", name)
+		}
+	}
+	for _, name := range cleared {
+		if !out.FieldByName(name).IsZero() {
+			t.Errorf("%s isn't cleared", name)
+		}
+	}
+}
+
+func TestHash_ignoreFuncs(t *testing.T) {
+	type Registry struct {
+		Name     string
+		OnChange func()
+		Handlers map[string]func() error
+		Hooks    []func()
+	}
+
+	f1 := func() {}
+	f2 := func() {}
+	opts := &HashOptions{IgnoreFuncs: true}
+	cases := []struct {
+		One, Two interface{}
+		Match    bool
+	}{
+		{[]func(){f1, f2}, []func(){f2, f1}, true},
+		{[]func(){f1, f2}, []func(){f1}, false},
+		{map[string]func(){"a": f1}, map[string]func(){"a": f2}, true},
+		{map[string]func(){"a": f1}, map[string]func(){"b": f1}, false},
+		{map[string]interface{}{"a": f1, "n": 1}, map[string]interface{}{"a": f2, "n": 1}, true},
+		{Registry{Name: "a", OnChange: f1}, Registry{Name: "a"}, true},
+		{Registry{Name: "a", OnChange: f1}, Registry{Name: "b", OnChange: f1}, false},
+		{
+			Registry{Handlers: map[string]func() error{"get": nil}, Hooks: []func(){f1}},
+			Registry{Handlers: map[string]func() error{"get": nil}, Hooks: []func(){f2}},
+			true,
+		},
+		{
+			Registry{Handlers: map[string]func() error{"get": nil}},
+			Registry{Handlers: map[string]func() error{"put": nil}},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		if _, err := Hash(tc.One, testFormat, nil); err == nil {
+			t.Fatalf("%d: expected error without IgnoreFuncs", i)
+		}
+
+		one, err := Hash(tc.One, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Skipped funcs are reported
+	var ignored []string
+	opts.OnIgnore = func(path, reason string) {
+		ignored = append(ignored, path+" "+reason)
+	}
+	v := Registry{OnChange: f1, Hooks: []func(){f1}}
+	if _, err := Hash(v, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{"OnChange func", "Hooks[0] func"}
+	if !reflect.DeepEqual(ignored, expected) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+}
+
+func TestHash_bufferSize(t *testing.T) {
+	type Item struct {
+		Name  string
+		Count int
+		Tags  []string `hash:"set"`
+		Data  []byte
+		When  time.Time
+		Inner *Item
+	}
+
+	values := []interface{}{
+		42,
+		"foo",
+		Item{
+			Name:  "foo",
+			Count: 3,
+			Tags:  []string{"a", "b"},
+			Data:  bytes.Repeat([]byte("x"), 100),
+			When:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Inner: &Item{Name: "bar"},
+		},
+		map[string]interface{}{"a": []interface{}{1, "b", nil}},
+		[16]byte{1, 2, 3},
+	}
+
+	opts := []HashOptions{
+		{},
+		{ResetPolicy: ResetNever},
+		{MaxBytes: 1 << 20},
+		{Logger: func(string, reflect.Kind, int) {}},
+		{HasherFactory: fnv.New64a},
+	}
+
+	for i, v := range values {
+		for j := range opts {
+			// Each hash gets a new Hasher, since ResetNever keeps state
+			o := opts[j]
+			expected, err := Hash(v, testFormat, &o)
+			if err != nil {
+				t.Fatalf("%d/%d: err: %s", i, j, err)
+			}
+
+			for _, size := range []int{1, 7, 64, 4096} {
+				o := opts[j]
+				o.BufferSize = size
+				actual, err := Hash(v, testFormat, &o)
+				if err != nil {
+					t.Fatalf("%d/%d: err: %s", i, j, err)
+				}
+
+				if actual != expected {
+					t.Fatalf("%d/%d: buffer of %d changed the hash", i, j, size)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkHash_bufferSize(b *testing.B) {
+	type Field struct {
+		A, B, C int
+		D, E    string
+		F       bool
+	}
+
+	v := make([]Field, 100)
+	for _, size := range []int{0, 64, 4096} {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			opts := &HashOptions{BufferSize: size}
+			for i := 0; i < b.N; i++ {
+				if _, err := Hash(v, testFormat, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// testHashMarshaler is hashed by its ID alone, leaving out its cache.
+type testHashMarshaler struct {
+	ID    string
+	Cache map[string]int
+	Err   error
+}
+
+func (v testHashMarshaler) MarshalHash() ([]byte, error) {
+	return []byte(v.ID), v.Err
+}
+
+func TestHash_hashMarshaler(t *testing.T) {
+	type Doc struct {
+		Key  testHashMarshaler
+		Keys []*testHashMarshaler
+	}
+
+	opts := &HashOptions{UseHashMarshaler: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			testHashMarshaler{ID: "a"},
+			testHashMarshaler{ID: "a", Cache: map[string]int{"x": 1}},
+			opts,
+			true,
+		},
+		{
+			testHashMarshaler{ID: "a"},
+			testHashMarshaler{ID: "a", Cache: map[string]int{"x": 1}},
+			nil,
+			false,
+		},
+		{testHashMarshaler{ID: "a"}, testHashMarshaler{ID: "b"}, opts, false},
+		{
+			Doc{Key: testHashMarshaler{ID: "a", Cache: map[string]int{"x": 1}}},
+			Doc{Key: testHashMarshaler{ID: "a"}},
+			opts,
+			true,
+		},
+		{
+			Doc{Keys: []*testHashMarshaler{{ID: "a", Cache: map[string]int{"x": 1}}}},
+			Doc{Keys: []*testHashMarshaler{{ID: "a"}}},
+			opts,
+			true,
+		},
+		{
+			Doc{Keys: []*testHashMarshaler{{ID: "a"}, nil}},
+			Doc{Keys: []*testHashMarshaler{{ID: "a"}}},
+			opts,
+			false,
+		},
+		{
+			[]interface{}{testHashMarshaler{ID: "a", Cache: map[string]int{"x": 1}}},
+			[]interface{}{testHashMarshaler{ID: "a"}},
+			opts,
+			true,
+		},
+		{
+			map[string]interface{}{"key": &testHashMarshaler{ID: "a", Cache: map[string]int{"x": 1}}},
+			map[string]interface{}{"key": &testHashMarshaler{ID: "a"}},
+			opts,
+			true,
+		},
+
+		// The bytes are length-prefixed, so they don't run together
+		{
+			[]testHashMarshaler{{ID: "ab"}, {ID: "c"}},
+			[]testHashMarshaler{{ID: "a"}, {ID: "bc"}},
+			opts,
+			false,
+		},
+
+		// Marshaler takes precedence
+		{
+			testHashMarshaler{ID: "a"},
+			testHashMarshaler{ID: "b"},
+			&HashOptions{
+				UseHashMarshaler: true,
+				Marshaler: func(v interface{}) ([]byte, bool, error) {
+					return nil, true, nil
+				},
+			},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Errors are returned
+	expected := errors.New("marshal failed")
+	_, err := Hash(Doc{Key: testHashMarshaler{Err: expected}}, testFormat, opts)
+	if err != expected {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestHash_includeSliceCap(t *testing.T) {
+	type Buffer struct {
+		Data []int
+	}
+
+	backing := []int{1, 2, 3, 4}
+	opts := &HashOptions{IncludeSliceCap: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{backing[:2], append(make([]int, 0, 8), 1, 2), nil, true},
+		{backing[:2], append(make([]int, 0, 8), 1, 2), opts, false},
+		{backing[:2], backing[:2:2], opts, false},
+		{backing[:2], append(make([]int, 0, 4), 1, 2), opts, true},
+		{backing[1:3], backing[1:3:3], opts, false},
+		{backing[1:3], backing[1:3:3], &HashOptions{}, true},
+		{
+			Buffer{Data: backing[:2]},
+			Buffer{Data: backing[:2:2]},
+			opts,
+			false,
+		},
+		{
+			Buffer{Data: backing[:2:2]},
+			Buffer{Data: []int{1, 2}},
+			opts,
+			true,
+		},
+		{
+			map[string][]int{"a": backing[:1]},
+			map[string][]int{"a": backing[:1:1]},
+			opts,
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
+
+func TestHash_hmacKey(t *testing.T) {
+	type Config struct {
+		Name    string
+		Servers []string
+		Limits  map[string]int
+	}
+
+	v := Config{
+		Name:    "prod",
+		Servers: []string{"a", "b"},
+		Limits:  map[string]int{"cpu": 2, "mem": 4},
+	}
+	hashWith := func(opts *HashOptions) uint64 {
+		h, err := Hash(v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return h
+	}
+
+	keyA := []byte("key a")
+	keyB := []byte("key b")
+
+	// Stable for a fixed key
+	one := hashWith(&HashOptions{HMACKey: keyA})
+	if two := hashWith(&HashOptions{HMACKey: []byte("key a")}); one != two {
+		t.Fatalf("same key gave %d and %d", one, two)
+	}
+
+	// Different keys, or no key, give different hashes
+	if two := hashWith(&HashOptions{HMACKey: keyB}); one == two {
+		t.Fatal("different keys gave the same hash")
+	}
+	if two := hashWith(nil); one == two {
+		t.Fatal("key didn't change the hash")
+	}
+	if two := hashWith(&HashOptions{HMACKey: keyA, HMACHash: sha512.New}); one == two {
+		t.Fatal("hash function didn't change the hash")
+	}
+
+	// The Hasher isn't used
+	if two := hashWith(&HashOptions{HMACKey: keyA, Hasher: fnv.New64a()}); one != two {
+		t.Fatal("Hasher changed the hash")
+	}
+	if two := hashWith(&HashOptions{HMACKey: keyA, HasherFactory: fnv.New64a}); one != two {
+		t.Fatal("HasherFactory changed the hash")
+	}
+
+	// Parallel maps use the key too
+	if two := hashWith(&HashOptions{HMACKey: keyA, Parallel: true}); one != two {
+		t.Fatal("Parallel changed the hash")
+	}
+
+	// MerkleHash matches Hash
+	s := []string{"a", "b", "c"}
+	r, err := MerkleHash(s, testFormat, &HashOptions{HMACKey: keyA})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, err := Hash(s, testFormat, &HashOptions{HMACKey: keyA, Merkle: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if r.Root() != expected {
+		t.Fatalf("root %d doesn't match hash %d", r.Root(), expected)
+	}
+
+	// Hash functions too short for Sum64 are an error
+	short := &HashOptions{HMACKey: keyA, HMACHash: func() hash.Hash { return crc32.NewIEEE() }}
+	if _, err := Hash(s, testFormat, short); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := MerkleHash(s, testFormat, short); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// testPluginA and testPluginB are plugin configs whose values can't be
+// told apart without their types.
+type testPluginA map[string]string
+type testPluginB map[string]string
+
+func TestHash_typeNames(t *testing.T) {
+	type Config struct {
+		Plugins []interface{}
+		Main    interface{}
+	}
+
+	names := map[reflect.Type]string{
+		reflect.TypeOf(testPluginA(nil)): "plugin.a",
+		reflect.TypeOf(testPluginB(nil)): "plugin.b",
+	}
+	opts := &HashOptions{TypeNames: names}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{Config{Main: testPluginA{"n": "x"}}, Config{Main: testPluginB{"n": "x"}}, nil, true},
+		{Config{Main: testPluginA{"n": "x"}}, Config{Main: testPluginB{"n": "x"}}, opts, false},
+		{Config{Main: testPluginA{"n": "x"}}, Config{Main: &testPluginA{"n": "x"}}, opts, true},
+		{Config{Main: testPluginA{"n": "x"}}, Config{Main: testPluginA{"n": "y"}}, opts, false},
+		{
+			Config{Plugins: []interface{}{testPluginA{"n": "x"}, testPluginB{"n": "y"}}},
+			Config{Plugins: []interface{}{testPluginB{"n": "x"}, testPluginA{"n": "y"}}},
+			opts,
+			false,
+		},
+		{
+			map[string]interface{}{"p": testPluginA{"n": "x"}},
+			map[string]interface{}{"p": testPluginB{"n": "x"}},
+			opts,
+			false,
+		},
+
+		// Only the registered name matters, not the type
+		{
+			Config{Main: testPluginA{"n": "x"}},
+			Config{Main: testPluginB{"n": "x"}},
+			&HashOptions{TypeNames: map[reflect.Type]string{
+				reflect.TypeOf(testPluginA(nil)): "plugin",
+				reflect.TypeOf(testPluginB(nil)): "plugin",
+			}},
+			true,
+		},
+
+		// Other types are named by their package path and name
+		{Config{Main: 1}, Config{Main: uint(1)}, nil, true},
+		{Config{Main: 1}, Config{Main: uint(1)}, opts, false},
+		{Config{}, Config{}, opts, true},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// The registered name is hashed in place of the type's own name, so
+	// the hash doesn't change if the type is renamed or moved.
+	renamed := map[reflect.Type]string{
+		reflect.TypeOf(testPluginB(nil)): "plugin.a",
+	}
+	one, err := Hash(Config{Main: testPluginA{"n": "x"}}, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	two, err := Hash(Config{Main: testPluginB{"n": "x"}}, testFormat, &HashOptions{TypeNames: renamed})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if one != two {
+		t.Fatal("registered name wasn't used")
+	}
+}
+
+func TestHash_ignoreInterfaces(t *testing.T) {
+	type Job struct {
+		Name   string
+		Input  io.Reader
+		Output io.Writer
+		Any    interface{}
+	}
+
+	opts := &HashOptions{
+		IgnoreInterfaces: []reflect.Type{
+			reflect.TypeOf((*io.Reader)(nil)).Elem(),
+			reflect.TypeOf((*io.Writer)(nil)).Elem(),
+		},
+	}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		{
+			Job{Name: "a", Input: strings.NewReader("x"), Output: &bytes.Buffer{}},
+			Job{Name: "a"},
+			opts,
+			true,
+		},
+		{Job{Name: "a", Input: strings.NewReader("x")}, Job{Name: "b"}, opts, false},
+		{Job{Name: "a", Input: strings.NewReader("x")}, Job{Name: "a"}, nil, false},
+
+		// Only the declared type matters
+		{Job{Name: "a", Any: strings.NewReader("x")}, Job{Name: "a"}, opts, false},
+		{
+			map[string]*Job{"j": {Name: "a", Output: &bytes.Buffer{}}},
+			map[string]*Job{"j": {Name: "a", Output: os.Stdout}},
+			opts,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Skipped fields are reported
+	var ignored []string
+	opts.OnIgnore = func(path, reason string) {
+		ignored = append(ignored, path+" "+reason)
+	}
+	if _, err := Hash(Job{Name: "a"}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{"Input interface", "Output interface"}
+	if !reflect.DeepEqual(ignored, expected) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+}
+
+func TestHash_concurrentOptions(t *testing.T) {
+	type Item struct {
+		Name  string
+		Tags  []string `hash:"set"`
+		Attrs map[string]interface{}
+	}
+
+	values := []interface{}{
+		"foo",
+		42,
+		Item{Name: "a", Tags: []string{"x", "y"}, Attrs: map[string]interface{}{"n": 1}},
+		map[string]Item{"b": {Name: "b"}},
+	}
+
+	for i, opts := range []*HashOptions{
+		nil,
+		{},
+		{Hasher: fnv.New64()},
+		{Hasher: fnv.New64a(), ResetPolicy: ResetNever},
+		{HasherFactory: fnv.New64},
+		{Parallel: true},
+	} {
+		// Compute the expected hashes with options that aren't shared
+		expected := make([]uint64, len(values))
+		for j, v := range values {
+			var o *HashOptions
+			if opts != nil {
+				copied := *opts
+				if copied.Hasher != nil {
+					copied.Hasher, _ = cloneHasher(copied.Hasher)
+				}
+				o = &copied
+			}
+
+			h, err := Hash(v, testFormat, o)
+			if err != nil {
+				t.Fatalf("%d: err: %s", i, err)
+			}
+			expected[j] = h
+		}
+
+		// Then hammer the shared options
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < 100; n++ {
+					for j, v := range values {
+						h, err := Hash(v, testFormat, opts)
+						if err != nil {
+							errs <- err
+							return
+						}
+						if h != expected[j] {
+							errs <- fmt.Errorf("value %d hashed to %d, expected %d", j, h, expected[j])
+							return
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatalf("%d: %s", i, err)
+		}
+	}
+}
+
+// testTenantKey is the context key for the tenant in TestHashContext.
+type testTenantKey struct{}
+
+func TestHashContext(t *testing.T) {
+	type Email string
+	type User struct {
+		ID    int
+		Email Email
+		Phone string
+	}
+
+	emailType := reflect.TypeOf(Email(""))
+	redact := func(interface{}) interface{} { return "redacted" }
+	opts := &HashOptions{
+		ContextTransformers: func(ctx context.Context) map[reflect.Type]func(interface{}) interface{} {
+			// Only the strict tenant redacts emails
+			if ctx.Value(testTenantKey{}) == "strict" {
+				return map[reflect.Type]func(interface{}) interface{}{
+					emailType: redact,
+				}
+			}
+
+			return nil
+		},
+	}
+
+	strict := context.WithValue(context.Background(), testTenantKey{}, "strict")
+	lax := context.WithValue(context.Background(), testTenantKey{}, "lax")
+	one := User{ID: 1, Email: "a@example.com"}
+	two := User{ID: 1, Email: "b@example.com"}
+
+	hashCtx := func(ctx context.Context, v interface{}, opts *HashOptions) uint64 {
+		h, err := HashContext(ctx, v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return h
+	}
+
+	if hashCtx(strict, one, opts) != hashCtx(strict, two, opts) {
+		t.Fatal("strict tenant should redact emails")
+	}
+	if hashCtx(lax, one, opts) == hashCtx(lax, two, opts) {
+		t.Fatal("lax tenant shouldn't redact emails")
+	}
+	if hashCtx(lax, one, opts) != hashCtx(context.Background(), one, nil) {
+		t.Fatal("no transformers should hash like Hash")
+	}
+
+	// Hash ignores ContextTransformers
+	h1, err := Hash(one, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	h2, err := Hash(two, testFormat, opts)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h1 == h2 {
+		t.Fatal("Hash shouldn't use ContextTransformers")
+	}
+
+	// Transformers from the context take precedence
+	withOwn := *opts
+	withOwn.Transformers = map[reflect.Type]func(interface{}) interface{}{
+		emailType: func(v interface{}) interface{} { return v },
+	}
+	if hashCtx(strict, one, &withOwn) != hashCtx(strict, two, &withOwn) {
+		t.Fatal("context transformers should take precedence")
+	}
+	if hashCtx(lax, one, &withOwn) == hashCtx(lax, two, &withOwn) {
+		t.Fatal("own transformers should still apply")
+	}
+
+	// The options aren't modified
+	if withOwn.Transformers[emailType] == nil || len(withOwn.Transformers) != 1 {
+		t.Fatal("options were modified")
+	}
+}
+
+func TestHash_pointerMapKeys(t *testing.T) {
+	type Key struct {
+		ID int
+	}
+
+	a1, a2 := &Key{1}, &Key{1}
+	b1, b2 := &Key{2}, &Key{2}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// Keys that point to equal values are distinct entries
+		{map[*Key]int{a1: 1, a2: 1}, map[*Key]int{}, nil, false},
+		{map[*Key]int{a1: 1, a2: 1}, map[*Key]int{a1: 1}, nil, false},
+		{map[*Key]int{a1: 1, a2: 1, b1: 2}, map[*Key]int{b1: 2}, nil, false},
+
+		// Keys are hashed by what they point to, not by address
+		{map[*Key]int{a1: 1, b1: 2}, map[*Key]int{a2: 1, b2: 2}, nil, true},
+		{map[*Key]int{a1: 1, b1: 2}, map[*Key]int{a1: 2, b1: 1}, nil, false},
+		{map[*Key]int{a1: 1, a2: 2}, map[*Key]int{a1: 2, a2: 1}, nil, true},
+		{map[*Key]int{a1: 1, a2: 1}, map[*Key]int{b1: 1, b2: 1}, nil, false},
+
+		// OrderedMaps hashes them the same way
+		{
+			map[*Key]int{a1: 1, b1: 2},
+			map[*Key]int{a1: 1, b1: 2},
+			&HashOptions{OrderedMaps: true},
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// The hash is the same with OrderedMaps and in parallel, with enough
+	// keys to be split
+	v := make(map[*Key]int)
+	for i := 0; i < 2*parallelMinKeys; i++ {
+		v[&Key{i % 10}] = i % 3
+	}
+	expected, err := Hash(v, testFormat, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, opts := range []*HashOptions{{OrderedMaps: true}, {Parallel: true}} {
+		actual, err := Hash(v, testFormat, opts)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != expected {
+			t.Fatalf("%#v changed the hash", opts)
+		}
+	}
+}
+
+func TestHash_redactTag(t *testing.T) {
+	type Redacted struct {
+		Host     string
+		Password string `hash:"redact"`
+	}
+	type Ignored struct {
+		Host     string
+		Password string `hash:"ignore"`
+	}
+	type Plain struct {
+		Host     string
+		Password string
+	}
+
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// A set secret hashes like an empty one
+		{Redacted{"db", "hunter2"}, Redacted{"db", ""}, nil, true},
+		{Redacted{"db", "hunter2"}, Redacted{"db", "swordfish"}, nil, true},
+		{Redacted{"db", "hunter2"}, Redacted{"db", ""}, &HashOptions{IgnoreZeroValue: true}, true},
+		{Plain{"db", "hunter2"}, Plain{"db", ""}, nil, false},
+		{Redacted{"db", "hunter2"}, Redacted{"other", "hunter2"}, nil, false},
+
+		// Unlike ignore, the field is still part of the hash
+		{Ignored{"db", "hunter2"}, Ignored{"db", ""}, nil, true},
+		{
+			struct {
+				Host     string
+				Password string `hash:"redact"`
+			}{Host: "db"},
+			struct{ Host string }{"db"},
+			nil,
+			false,
+		},
+		{
+			struct {
+				Host     string
+				Password string `hash:"ignore"`
+			}{Host: "db"},
+			struct{ Host string }{"db"},
+			nil,
+			true,
+		},
+
+		// The field is hashed like any other, along with its tag
+		{
+			struct {
+				Password string `hash:"redact"`
+			}{"hunter2"},
+			struct {
+				Password string `hash:"redact" json:"password"`
+			}{"hunter2"},
+			&HashOptions{IncludeTags: true},
+			false,
+		},
+		{
+			struct {
+				Password string `hash:"redact"`
+			}{"hunter2"},
+			struct {
+				Password string `hash:"redact" json:"password"`
+			}{"hunter2"},
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+
+	// Redacted fields are reported
+	var ignored []string
+	opts := &HashOptions{
+		OnIgnore: func(path, reason string) {
+			ignored = append(ignored, path+" "+reason)
+		},
+	}
+	if _, err := Hash(Redacted{"db", "hunter2"}, testFormat, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ignored, []string{"Password redact"}) {
+		t.Fatalf("bad: %#v", ignored)
+	}
+}
+
+func TestHash_numericAsString(t *testing.T) {
+	a, b := 0.1, 0.2
+	opts := &HashOptions{NumericAsString: true}
+	asStrings := &HashOptions{NumericAsString: true, NumbersMatchStrings: true}
+	cases := []struct {
+		One, Two interface{}
+		Opts     *HashOptions
+		Match    bool
+	}{
+		// Numbers hash by their decimal text
+		{1.0, 1, opts, true},
+		{1.0, "1", opts, false},
+		{1, "1", opts, false},
+		{int8(42), uint64(42), opts, true},
+		{float32(1.1), 1.1, opts, true},
+		{1.5, 1.25, opts, false},
+		{-1, 1, opts, false},
+		{a + b, 0.3, opts, false},
+		{map[string]int{"a": 1}, map[string]float64{"a": 1.0}, opts, true},
+		{map[string]int{"a": 1}, map[string]string{"a": "1"}, opts, false},
+
+		// Numbers match strings only if requested
+		{1.0, "1", asStrings, true},
+		{1.0, 1, asStrings, true},
+		{math.Inf(1), "+Inf", asStrings, true},
+		{1e21, "1e+21", asStrings, true},
+		{map[string]int{"a": 1}, map[string]string{"a": "1"}, asStrings, true},
+		{[]interface{}{1, 2.5}, []string{"1", "2.5"}, asStrings, true},
+		{1, "1", &HashOptions{NumbersMatchStrings: true}, false},
+
+		// Floats are rounded first
+		{a + b, 0.3, &HashOptions{NumericAsString: true, FloatPrecision: 2}, true},
+
+		// NaN is always the same text
+		{math.NaN(), "NaN", &HashOptions{NumericAsString: true, NumbersMatchStrings: true, Deterministic: true}, true},
+		{math.NaN(), math.NaN(), &HashOptions{NumericAsString: true, Deterministic: true}, true},
+
+		// Numbers are still numbers with ScalarCategories
+		{1, "1", &HashOptions{NumericAsString: true, ScalarCategories: true}, false},
+		{1.0, "1", &HashOptions{NumericAsString: true, ScalarCategories: true}, false},
+		{1.0, 1, &HashOptions{NumericAsString: true, ScalarCategories: true}, true},
+		{int8(42), uint64(42), &HashOptions{NumericAsString: true, ScalarCategories: true}, true},
+		{"1", "1", &HashOptions{NumericAsString: true, ScalarCategories: true}, true},
+		{1, "1", &HashOptions{NumericAsString: true, NumbersMatchStrings: true, ScalarCategories: true}, false},
+
+		// Booleans and complex numbers aren't numbers in text
+		{true, 1, opts, false},
+		{true, "1", opts, false},
+		{complex64(1), 1, opts, false},
+
+		// It is off by default
+		{1.0, 1, nil, false},
+		{1, "1", nil, false},
+		{float32(1.1), 1.1, nil, false},
+	}
+
+	for i, tc := range cases {
+		one, err := Hash(tc.One, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.One, err)
+		}
+		two, err := Hash(tc.Two, testFormat, tc.Opts)
+		if err != nil {
+			t.Fatalf("Failed to hash %#v: %s", tc.Two, err)
+		}
+
+		// Compare
+		if (one == two) != tc.Match {
+			t.Fatalf("%d: bad, expected: %#v\n\n%#v\n\n%#v", i, tc.Match, tc.One, tc.Two)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package hashstructure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// hmacHasher is a keyed hash.Hash64 built on HMAC. Since the walker
+// resets the hasher for every value it hashes and combines the results,
+// every step is keyed, so the final hash can't be computed without the
+// key.
+type hmacHasher struct {
+	hash.Hash
+}
+
+// newHMACFactory returns a function that creates HMAC hashers using the
+// hash function newHash, or SHA-256 if it is nil, with the given key. It
+// is an error if newHash gives fewer than 8 bytes, since Sum64 needs them.
+func newHMACFactory(newHash func() hash.Hash, key []byte) (func() hash.Hash64, error) {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	if size := newHash().Size(); size < 8 {
+		return nil, fmt.Errorf("hashstructure: HMACHash gives %d bytes, but at least 8 are needed", size)
+	}
+
+	return func() hash.Hash64 {
+		return &hmacHasher{Hash: hmac.New(newHash, key)}
+	}, nil
+}
+
+// Sum64 returns the first 8 bytes of the HMAC.
+func (h *hmacHasher) Sum64() uint64 {
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
@@ -14,6 +14,57 @@ type IncludableMap interface {
 	HashIncludeMap(field string, k, v interface{}) (bool, error)
 }
 
+// TransformableMap is an interface that can optionally be implemented by
+// a struct. It works like IncludableMap but also allows the struct to
+// replace the key and value that are hashed for each map item, for example
+// to normalize the case of keys. If a struct implements both, this is
+// preferred over IncludableMap.
+type TransformableMap interface {
+	HashMapEntry(field string, k, v interface{}) (nk, nv interface{}, include bool, err error)
+}
+
+// Ranger is an interface that can optionally be implemented by a struct
+// that is a collection, such as a generic set or map. Range must call f
+// for each entry until f returns false. The entries are hashed like the
+// entries of a map, so the order they are ranged over doesn't affect the
+// hash, and the struct fields are not hashed. A set can pass each element
+// as the key along with a constant value.
+//
+// For example, a generic Set[T comparable] backed by a map[T]struct{} can
+// range over its map, and hashes the same as the map itself. Since the
+// elements of a set are distinct, no element cancels out another, so a
+// subset hashes differently without the size of the set being hashed.
+type Ranger interface {
+	Range(f func(k, v interface{}) bool)
+}
+
+// OrderedRanger is like Ranger but for collections whose entries have a
+// defined order, such as maps that preserve insertion order. RangeOrdered
+// must call f for each entry in order until f returns false. The entries
+// are hashed in that order, so the same entries in a different order hash
+// differently, unlike with Ranger and built-in maps. If a struct implements
+// both, this is preferred over Ranger.
+type OrderedRanger interface {
+	RangeOrdered(f func(k, v interface{}) bool)
+}
+
+// Canonicalizer is an interface that can optionally be implemented by any
+// type to provide a normalized form of the value to hash in its place, for
+// example with internal slices sorted. This is only used if
+// HashOptions.UseCanonical is set.
+type Canonicalizer interface {
+	Canonical() interface{}
+}
+
+// HashMarshaler is an interface that can optionally be implemented by any
+// type to provide the exact bytes to hash in its place. Unlike the
+// encoding marshalers, this is meant for a form specific to hashing that
+// can differ from how the value is serialized, for example leaving out a
+// cache. This is only used if HashOptions.UseHashMarshaler is set.
+type HashMarshaler interface {
+	MarshalHash() ([]byte, error)
+}
+
 // Hashable is an interface that can optionally be implemented by a struct
 // to override the hash value. This value will override the hash value for
 // the entire struct. Entries in the struct will not be hashed.
@@ -0,0 +1,65 @@
+package hashstructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash"
+	"reflect"
+)
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// visitRawMessage hashes the bytes of a json.RawMessage, canonicalizing
+// them first if CanonicalRawMessages is set.
+func (w *walker) visitRawMessage(b []byte) (uint64, error) {
+	if w.canonicalRaw {
+		var err error
+		if b, err = canonicalJSON(json.RawMessage(b)); err != nil {
+			return 0, err
+		}
+	}
+
+	return w.visitBytes(b)
+}
+
+// hashJSON hashes the canonical JSON encoding of v. See
+// HashOptions.CanonicalJSON for what canonical means here.
+func hashJSON(h hash.Hash64, v interface{}) (uint64, error) {
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return 0, err
+	}
+
+	h.Reset()
+	_, err = h.Write(b)
+	return h.Sum64(), err
+}
+
+// canonicalJSON encodes v as JSON with all object keys sorted, no
+// insignificant whitespace and no HTML escaping.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Struct fields are encoded in declaration order, so decode into
+	// generic values (which keeps numbers exactly as written) and encode
+	// again. Maps are always encoded with sorted keys.
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+
+	// Encode always adds a trailing newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
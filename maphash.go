@@ -0,0 +1,22 @@
+package hashstructure
+
+import (
+	"hash"
+	"hash/maphash"
+	"reflect"
+)
+
+var maphashType = reflect.TypeOf(&maphash.Hash{})
+
+// NewMaphashHasher returns a hash.Hash64 backed by hash/maphash with a new
+// random seed. It can be set as HashOptions.Hasher to get hashes that are
+// resistant to collision attacks when hashing untrusted input.
+//
+// The seed is random and private to the returned hasher, so hashes are only
+// comparable when generated with the same hasher. They will differ between
+// processes and must not be persisted.
+func NewMaphashHasher() hash.Hash64 {
+	var h maphash.Hash
+	h.SetSeed(maphash.MakeSeed())
+	return &h
+}
@@ -0,0 +1,322 @@
+package hashstructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"reflect"
+)
+
+// MerkleResult is the Merkle tree of a slice hashed by MerkleHash. It can
+// be updated as elements of the slice change, without rehashing the other
+// elements. A MerkleResult is not safe for concurrent use.
+type MerkleResult struct {
+	h     hash.Hash64
+	order binary.ByteOrder
+
+	// w walks the elements, the same way Hash does within the slice. elem
+	// is the element type, which elements given to Update are converted
+	// to so that they're hashed as if they were in the slice.
+	w    *walker
+	elem reflect.Type
+
+	// levels are the levels of the tree, from the element hashes up to
+	// the single top node.
+	levels [][]uint64
+	// nilMarker is set for a nil slice hashed with IncludeNilMarker, which
+	// has nilRoot as its root rather than a tree. It has no elements to
+	// update.
+	nilMarker bool
+	nilRoot   uint64
+}
+
+// MerkleHash hashes the slice v as a Merkle tree over the hashes of its
+// elements, as Hash does with the Merkle option set. The returned
+// MerkleResult has the same Root as the hash from Hash, and can be
+// updated in O(log n) when a single element changes.
+//
+// Each element is hashed on its own, so options that depend on where an
+// element is or on the other elements aren't supported, and cause an
+// error: Prune, SkipNaN, SlicesAsSets, SliceDedup, IncludeSliceCap,
+// StringifyAll, CanonicalJSON and ResetNever. It is also an error if the
+// slice as a whole would be hashed by a transformer, the Marshaler or one
+// of the interfaces that options such as UseHashMarshaler use. PreHash is
+// applied to v, not to the elements given to Update, and MaxBytes limits
+// each call on its own.
+func MerkleHash(v interface{}, format Format, opts *HashOptions) (*MerkleResult, error) {
+	// Use the default format if none was given
+	if format == formatInvalid {
+		format = DefaultFormat
+	}
+	if format <= formatInvalid || format >= formatMax {
+		return nil, &ErrFormat{}
+	}
+
+	var o HashOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.DeepEqualSemantics {
+		o = *deepEqualOptions(&o)
+	}
+	o.Merkle = true
+	if name := merkleUnsupported(&o); name != "" {
+		return nil, fmt.Errorf("hashstructure: MerkleHash doesn't support %s", name)
+	}
+	if o.PreHash != nil {
+		var err error
+		if v, err = o.PreHash(v); err != nil {
+			return nil, err
+		}
+	}
+
+	s := indirectValue(reflect.ValueOf(v))
+	if s.Kind() != reflect.Slice {
+		return nil, errors.New("hashstructure: MerkleHash requires a slice")
+	}
+
+	r := &MerkleResult{elem: s.Type().Elem()}
+	newHash := o.HasherFactory
+	if o.HMACKey != nil {
+		var err error
+		if newHash, err = newHMACFactory(o.HMACHash, o.HMACKey); err != nil {
+			return nil, err
+		}
+		r.h = newHash()
+	} else if newHash != nil {
+		r.h = newHash()
+	} else if o.Hasher == nil {
+		r.h = fnv.New64()
+	} else {
+		r.h = o.Hasher
+		if c, ok := cloneHasher(r.h); ok && !o.ownHasher {
+			r.h = c
+		}
+	}
+	if newHash == nil && reflect.TypeOf(r.h) == fnvType {
+		newHash = fnv.New64
+	}
+	if o.Deterministic && reflect.TypeOf(r.h) == maphashType {
+		return nil, &ErrNondeterministic{Reason: "maphash hasher"}
+	}
+	r.order = o.ByteOrder
+	if r.order == nil {
+		r.order = binary.LittleEndian
+	}
+	r.h.Reset()
+
+	h := r.h
+	var counter *countingHasher
+	if o.Logger != nil || o.MaxBytes > 0 {
+		counter = &countingHasher{Hash64: h, max: o.MaxBytes}
+		h = counter
+	}
+	r.w = newWalker(format, h, r.order, &o)
+	r.w.newHash = newHash
+	r.w.counter = counter
+	if o.SharePointers {
+		var err error
+		if r.w.pointers, err = r.w.countPointers(s); err != nil {
+			return nil, err
+		}
+	}
+
+	for rv := reflect.ValueOf(v); rv.IsValid(); rv = rv.Elem() {
+		whole, err := r.w.hashesWhole(rv)
+		if err != nil {
+			return nil, err
+		}
+		if whole {
+			return nil, errors.New("hashstructure: MerkleHash requires a slice that is hashed by its elements")
+		}
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			break
+		}
+	}
+
+	// A nil slice is a marker rather than a tree if requested
+	if s.IsNil() && o.IncludeNilMarker {
+		root, err := r.w.visit(s, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		r.nilMarker = true
+		r.nilRoot = root
+	}
+
+	leaves := make([]uint64, s.Len())
+	for i := range leaves {
+		eh, err := r.visit(s, i, s.Index(i))
+		if err != nil {
+			return nil, err
+		}
+
+		leaves[i] = eh
+	}
+
+	r.levels = merkleLevels(r.h, r.order, leaves)
+	return r, nil
+}
+
+// visit hashes the element at index i of the slice s, which may be
+// invalid for elements given to Update.
+func (r *MerkleResult) visit(s reflect.Value, i int, elem reflect.Value) (uint64, error) {
+	// Elements that refer back to the slice are cycles, as they are in
+	// Hash.
+	if s.IsValid() {
+		r.w.visiting.enter(s)
+		defer r.w.visiting.leave(s)
+	}
+
+	r.w.pushIndex(i)
+	eh, err := r.w.visit(elem, nil)
+	r.w.popPath()
+	if err != nil {
+		return 0, err
+	}
+	if r.w.counter != nil && r.w.counter.tooLarge() {
+		return 0, &ErrTooLarge{MaxBytes: r.w.counter.max}
+	}
+
+	return eh, nil
+}
+
+// Root returns the hash of the whole slice.
+func (r *MerkleResult) Root() uint64 {
+	if r.nilMarker {
+		return r.nilRoot
+	}
+
+	return merkleRoot(r.h, r.order, r.levels)
+}
+
+// Len returns the number of elements in the slice.
+func (r *MerkleResult) Len() int {
+	return len(r.levels[0])
+}
+
+// Update replaces the element at index i with v and returns the new root.
+// Only v and the nodes above it are hashed again. With SharePointers, the
+// pointers in v are shared as MerkleHash counted them, not counted again.
+func (r *MerkleResult) Update(i int, v interface{}) (uint64, error) {
+	if i < 0 || i >= r.Len() {
+		return 0, errors.New("hashstructure: Merkle index out of range")
+	}
+
+	// Hash v as the element type where it can be, so that interface
+	// elements keep their interface layer
+	ev := reflect.ValueOf(v)
+	if !ev.IsValid() || ev.Type().AssignableTo(r.elem) {
+		e := reflect.New(r.elem).Elem()
+		if ev.IsValid() {
+			e.Set(ev)
+		}
+		ev = e
+	}
+
+	if r.w.counter != nil {
+		r.w.counter.n = 0
+	}
+	eh, err := r.visit(reflect.Value{}, i, ev)
+	if err != nil {
+		return 0, err
+	}
+
+	r.levels[0][i] = eh
+	for l := 1; l < len(r.levels); l++ {
+		i /= 2
+		r.levels[l][i] = merkleNode(r.h, r.order, r.levels[l-1], i)
+	}
+
+	return r.Root(), nil
+}
+
+// merkleUnsupported returns the name of the first option in o that
+// MerkleHash doesn't support, or "" if there is none.
+func merkleUnsupported(o *HashOptions) string {
+	switch {
+	case o.Prune != nil:
+		return "Prune"
+	case o.SkipNaN:
+		return "SkipNaN"
+	case o.SlicesAsSets:
+		return "SlicesAsSets"
+	case o.SliceDedup:
+		return "SliceDedup"
+	case o.IncludeSliceCap:
+		return "IncludeSliceCap"
+	case o.StringifyAll:
+		return "StringifyAll"
+	case o.CanonicalJSON:
+		return "CanonicalJSON"
+	case o.ResetPolicy == ResetNever:
+		return "ResetNever"
+	}
+
+	return ""
+}
+
+// hashesWhole returns true if w hashes v as a whole, by a transformer, the
+// Marshaler or an interface it implements, rather than by its contents.
+func (w *walker) hashesWhole(v reflect.Value) (bool, error) {
+	if w.transforming && w.transformerOf(v, nil) != nil {
+		return true, nil
+	}
+	if w.marshaler != nil && v.CanInterface() {
+		_, ok, err := w.marshaler(v.Interface())
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	_, hm := hashMarshalerOf(v)
+	_, c := canonicalizerOf(v)
+	_, gs := goStringerOf(v)
+	_, ge := gobEncoderOf(v)
+	_, dv := valuerOf(v)
+	return (w.hashMarshaler && hm) || (w.canonical && c) || (w.goStringer && gs) ||
+		(w.gobEncoder && ge) || (w.valuer && dv), nil
+}
+
+// merkleLevels builds the levels of a Merkle tree over the given leaves.
+// Each node is the ordered hash of its two children. A node without a
+// sibling is carried up unchanged.
+func merkleLevels(h hash.Hash64, order binary.ByteOrder, leaves []uint64) [][]uint64 {
+	levels := [][]uint64{leaves}
+	for level := leaves; len(level) > 1; {
+		next := make([]uint64, (len(level)+1)/2)
+		for i := range next {
+			next[i] = merkleNode(h, order, level, i)
+		}
+
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels
+}
+
+// merkleNode returns the node at index i of the level above children.
+func merkleNode(h hash.Hash64, order binary.ByteOrder, children []uint64, i int) uint64 {
+	if 2*i+1 == len(children) {
+		return children[2*i]
+	}
+
+	return hashUpdateOrdered(h, order, children[2*i], children[2*i+1])
+}
+
+// merkleRoot returns the hash of a slice from the levels of its tree. The
+// number of elements is included since trees of different sizes can
+// otherwise have the same top node, such as a single element slice and the
+// element itself.
+func merkleRoot(h hash.Hash64, order binary.ByteOrder, levels [][]uint64) uint64 {
+	n := len(levels[0])
+	if n == 0 {
+		return 0
+	}
+
+	return hashUpdateOrdered(h, order, uint64(n), levels[len(levels)-1][0])
+}
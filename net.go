@@ -0,0 +1,41 @@
+package hashstructure
+
+import (
+	"net"
+	"reflect"
+)
+
+var hardwareAddrType = reflect.TypeOf(net.HardwareAddr(nil))
+var ipType = reflect.TypeOf(net.IP(nil))
+var ipMaskType = reflect.TypeOf(net.IPMask(nil))
+
+// visitNetBytes hashes the network address or mask v, which is a byte
+// slice, by its bytes as a whole. IPv4 addresses are hashed in their 4 byte
+// form, so that equal addresses hash the same however they are stored. With
+// NamedTypeIdentity the name of the type is hashed too, so that a MAC
+// address and an IP address with the same bytes differ.
+func (w *walker) visitNetBytes(v reflect.Value) (uint64, error) {
+	b := v.Bytes()
+	if v.Type() == ipType {
+		if ip4 := net.IP(b).To4(); ip4 != nil {
+			b = ip4
+		}
+	}
+
+	h, err := w.visitBytes(b)
+	if err != nil {
+		return 0, err
+	}
+
+	if !w.namedTypes {
+		return h, nil
+	}
+
+	t := v.Type()
+	nh, err := w.visit(reflect.ValueOf(t.PkgPath()+"."+t.Name()), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, nh, h), nil
+}
@@ -0,0 +1,105 @@
+package hashstructure
+
+import (
+	"hash"
+)
+
+// WithHasher returns options that hash with a new hash function from
+// newHash for every call to Hash, so the options can be shared between
+// goroutines. The result can be further configured by chaining the With
+// methods, for example:
+//
+//	opts := hashstructure.WithHasher(fnv.New64a).
+//	    WithTagName("hashstructure").
+//	    WithZeroNil(true)
+func WithHasher(newHash func() hash.Hash64) *HashOptions {
+	return &HashOptions{HasherFactory: newHash}
+}
+
+// WithTagName sets TagName and returns the options for chaining. If o is
+// nil, new options are allocated.
+func (o *HashOptions) WithTagName(name string) *HashOptions {
+	o = o.orNew()
+	o.TagName = name
+	return o
+}
+
+// WithZeroNil sets ZeroNil and returns the options for chaining. If o is
+// nil, new options are allocated.
+func (o *HashOptions) WithZeroNil(v bool) *HashOptions {
+	o = o.orNew()
+	o.ZeroNil = v
+	return o
+}
+
+// WithIgnoreZeroValue sets IgnoreZeroValue and returns the options for
+// chaining. If o is nil, new options are allocated.
+func (o *HashOptions) WithIgnoreZeroValue(v bool) *HashOptions {
+	o = o.orNew()
+	o.IgnoreZeroValue = v
+	return o
+}
+
+// WithSlicesAsSets sets SlicesAsSets and returns the options for chaining.
+// If o is nil, new options are allocated.
+func (o *HashOptions) WithSlicesAsSets(v bool) *HashOptions {
+	o = o.orNew()
+	o.SlicesAsSets = v
+	return o
+}
+
+// WithUseStringer sets UseStringer and returns the options for chaining.
+// If o is nil, new options are allocated.
+func (o *HashOptions) WithUseStringer(v bool) *HashOptions {
+	o = o.orNew()
+	o.UseStringer = v
+	return o
+}
+
+func (o *HashOptions) orNew() *HashOptions {
+	if o == nil {
+		return &HashOptions{}
+	}
+
+	return o
+}
+
+// deepEqualOptions returns a copy of opts with the options set and cleared
+// as described by DeepEqualSemantics.
+func deepEqualOptions(opts *HashOptions) *HashOptions {
+	o := *opts
+	o.IncludeUnexported = true
+	o.IncludeNilMarker = true
+	o.NamedTypeIdentity = true
+	o.ScalarCategories = true
+	o.ArrayLengths = true
+	o.IgnoreSyncPrimitives = true
+
+	o.ZeroNil = false
+	o.IgnoreZeroValue = false
+	o.SlicesAsSets = false
+	o.SliceDedup = false
+	o.UseStringer = false
+	o.CanonicalNumbers = false
+	o.FloatPrecision = 0
+	o.IgnoreEmptyCollections = false
+	o.TimesAsInstants = false
+	o.TreatNilMapValuesAsMissing = false
+	o.CanonicalJSON = false
+	o.StringifyAll = false
+	o.UseCanonical = false
+	o.UseGoStringer = false
+	o.UseGobEncoder = false
+	o.UseValuer = false
+	o.UseHashMarshaler = false
+	o.UseGetters = false
+	o.IgnoreUnexportedStructs = false
+	o.SkipNaN = false
+	o.CanonicalRawMessages = false
+	o.IgnoreFuncs = false
+	o.IgnoreInterfaces = nil
+	o.NumericAsString = false
+	o.NumbersMatchStrings = false
+	o.URLsAsStrings = false
+	return &o
+}
@@ -0,0 +1,94 @@
+package hashstructure
+
+import (
+	"hash/fnv"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// parallelMinKeys is the minimum number of entries a map must have to be
+// hashed in parallel. Smaller maps aren't worth the overhead.
+const parallelMinKeys = 1024
+
+// fnvType is the type of the default Hasher. Since FNV has no key, new
+// ones can be created for parallel hashing in place of the one given.
+var fnvType = reflect.TypeOf(fnv.New64())
+
+// canParallel returns true if a map with n entries should be hashed in
+// parallel. This requires a way to create hash functions for each
+// goroutine, and isn't done while counting bytes since the count is
+// shared.
+func (w *walker) canParallel(n int) bool {
+	return w.parallel && w.newHash != nil && w.counter == nil && n >= parallelMinKeys
+}
+
+// fork returns a copy of w, with its own hash function and state, that can
+// visit children of the current value concurrently with w. Maps within
+// the children are not hashed in parallel again.
+func (w *walker) fork() *walker {
+	c := *w
+	c.h = w.newHash()
+	c.parallel = false
+	c.path = append([]pathElem(nil), w.path...)
+	c.visiting = make(cycleSet, len(w.visiting))
+	for k, v := range w.visiting {
+		c.visiting[k] = v
+	}
+	if w.getterTypes != nil {
+		c.getterTypes = make(map[reflect.Type]int, len(w.getterTypes))
+		for k, v := range w.getterTypes {
+			c.getterTypes[k] = v
+		}
+	}
+
+	return &c
+}
+
+// visitMapParallel is like visitMapEntries, but splits the keys into a
+// chunk per CPU that are hashed concurrently. The results are combined
+// into exactly what visitMapEntries would return, up to the order of
+// entries.
+func (w *walker) visitMapParallel(m reflect.Value, keys []reflect.Value, mv *mapVisit) (uint64, []mapEntryHash, error) {
+	n := runtime.GOMAXPROCS(0)
+	size := (len(keys) + n - 1) / n
+
+	type result struct {
+		h       uint64
+		entries []mapEntryHash
+		err     error
+	}
+
+	var results []result
+	for i := 0; i < len(keys); i += size {
+		results = append(results, result{})
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		end := (i + 1) * size
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		wg.Add(1)
+		go func(r *result, c *walker, keys []reflect.Value) {
+			defer wg.Done()
+			r.h, r.entries, r.err = c.visitMapEntries(m, keys, mv)
+		}(&results[i], w.fork(), keys[i*size:end])
+	}
+	wg.Wait()
+
+	var h uint64
+	var entries []mapEntryHash
+	for _, r := range results {
+		if r.err != nil {
+			return 0, nil, r.err
+		}
+
+		h = hashUpdateUnordered(h, r.h)
+		entries = append(entries, r.entries...)
+	}
+
+	return h, entries, nil
+}
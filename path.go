@@ -0,0 +1,67 @@
+package hashstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// pathElem is a single step from a value into one of its children while
+// walking. Exactly one of the fields is used: Field for struct fields, Key
+// for map values and Index for slice and array elements.
+type pathElem struct {
+	Field string
+	Key   reflect.Value
+	Index int
+}
+
+// pushField, pushKey and pushIndex record that the walker is descending
+// into a child of the current value. Each must be paired with a popPath
+// once the child has been visited.
+func (w *walker) pushField(name string) {
+	w.path = append(w.path, pathElem{Field: name})
+}
+
+func (w *walker) pushKey(k reflect.Value) {
+	w.path = append(w.path, pathElem{Key: k})
+}
+
+func (w *walker) pushIndex(i int) {
+	w.path = append(w.path, pathElem{Index: i})
+}
+
+func (w *walker) popPath() {
+	w.path = w.path[:len(w.path)-1]
+}
+
+// pathString renders the current path, such as "Foo.Bar[2][key]". This
+// is only done on demand since rendering map keys can be expensive.
+func (w *walker) pathString() string {
+	var b strings.Builder
+	for _, e := range w.path {
+		switch {
+		case e.Field != "":
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(e.Field)
+
+		case e.Key.IsValid():
+			b.WriteByte('[')
+			if e.Key.CanInterface() {
+				fmt.Fprintf(&b, "%v", e.Key.Interface())
+			} else {
+				b.WriteString(e.Key.String())
+			}
+			b.WriteByte(']')
+
+		default:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(e.Index))
+			b.WriteByte(']')
+		}
+	}
+
+	return b.String()
+}
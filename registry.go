@@ -0,0 +1,85 @@
+package hashstructure
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// registry holds the transformers installed by RegisterType. The map is
+// replaced rather than modified, so it is loaded without taking the lock,
+// which only serializes calls to RegisterType.
+var registry struct {
+	sync.Mutex
+	transformers atomic.Value // map[reflect.Type]func(interface{}) interface{}
+}
+
+// RegisterType installs fn as a process-wide transformer for values of
+// exactly the type t. Whenever Hash encounters such a value, it hashes the
+// value returned by fn instead, for example:
+//
+//	hashstructure.RegisterType(reflect.TypeOf(time.Time{}), func(v interface{}) interface{} {
+//	    return v.(time.Time).UnixNano()
+//	})
+//
+// A nil fn removes the transformer for t. RegisterType is safe to call
+// concurrently with itself and with Hash, but a call to Hash that is
+// already running keeps using the transformers installed when it started.
+//
+// Transformers given in HashOptions.Transformers take precedence over
+// registered ones. Both take precedence over all other handling of the
+// value, including Marshaler, Canonicalizer and Hashable.
+func RegisterType(t reflect.Type, fn func(interface{}) interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	old := registeredTransformers()
+	m := make(map[reflect.Type]func(interface{}) interface{}, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+
+	if fn == nil {
+		delete(m, t)
+	} else {
+		m[t] = fn
+	}
+
+	registry.transformers.Store(m)
+}
+
+// registeredTransformers returns the transformers currently installed by
+// RegisterType. The result must not be modified.
+func registeredTransformers() map[reflect.Type]func(interface{}) interface{} {
+	m, _ := registry.transformers.Load().(map[reflect.Type]func(interface{}) interface{})
+	return m
+}
+
+// transformerOf returns the transformer for the value v, if any. Values
+// that were already transformed aren't transformed again, since a
+// transformer may well return the same type.
+func (w *walker) transformerOf(v reflect.Value, opts *visitOpts) func(interface{}) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	if opts != nil && opts.Flags&visitFlagTransformed != 0 {
+		return nil
+	}
+
+	if fn, ok := w.transformers[v.Type()]; ok {
+		return fn
+	}
+
+	return w.registered[v.Type()]
+}
+
+// visitTransformed hashes the result of calling fn with v.
+func (w *walker) visitTransformed(fn func(interface{}) interface{}, v reflect.Value, opts *visitOpts) (uint64, error) {
+	newOpts := &visitOpts{Flags: visitFlagTransformed}
+	if opts != nil {
+		*newOpts = *opts
+		newOpts.Flags |= visitFlagTransformed
+	}
+
+	return w.visit(reflect.ValueOf(fn(v.Interface())), newOpts)
+}
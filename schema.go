@@ -0,0 +1,210 @@
+package hashstructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+)
+
+// SchemaHash returns a hash of the type t rather than of any value. The hash
+// covers the kind and name of the type and, recursively, of the types it is
+// built from. For structs this includes the name, full tag and type of each
+// exported field that isn't ignored, in declaration order.
+//
+// This is useful to detect when a type definition changes, for example to
+// invalidate caches keyed by a type. Only the Hasher, HasherFactory, TagName,
+// NameTag and ByteOrder options are used.
+func SchemaHash(t reflect.Type, opts *HashOptions) (uint64, error) {
+	if t == nil {
+		return 0, errors.New("hashstructure: SchemaHash requires a non-nil type")
+	}
+
+	// Create default options
+	if opts == nil {
+		opts = &HashOptions{}
+	}
+	h := opts.Hasher
+	if opts.HasherFactory != nil {
+		h = opts.HasherFactory()
+	} else if h == nil {
+		h = fnv.New64()
+	} else if c, ok := cloneHasher(h); ok {
+		h = c
+	}
+	tag := opts.TagName
+	if tag == "" {
+		tag = "hash"
+	}
+	order := opts.ByteOrder
+	if order == nil {
+		order = binary.LittleEndian
+	}
+
+	w := &schemaWalker{
+		h:        h,
+		order:    order,
+		tag:      tag,
+		nameTag:  opts.NameTag,
+		visiting: make(map[reflect.Type]struct{}),
+	}
+	return w.visit(t)
+}
+
+type schemaWalker struct {
+	h       hash.Hash64
+	order   binary.ByteOrder
+	tag     string
+	nameTag string
+
+	// visiting are the named types currently being visited, since types
+	// can refer to themselves through pointers, slices, maps and funcs.
+	visiting map[reflect.Type]struct{}
+}
+
+// schemaBackRef is hashed in place of a type that is already being
+// visited.
+const schemaBackRef = "hashstructure: backref"
+
+func (w *schemaWalker) visit(t reflect.Type) (uint64, error) {
+	h, err := w.hashString(t.Kind().String())
+	if err != nil {
+		return 0, err
+	}
+
+	if t.Name() != "" {
+		if h, err = w.update(h, t.PkgPath()+"."+t.Name()); err != nil {
+			return 0, err
+		}
+
+		// If we're already in this type then refer back to it, since
+		// named types can refer to themselves through pointers, slices,
+		// maps and funcs.
+		if _, ok := w.visiting[t]; ok {
+			return w.update(h, schemaBackRef)
+		}
+		w.visiting[t] = struct{}{}
+		defer delete(w.visiting, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		if h, err = w.update(h, strconv.Itoa(t.Len())); err != nil {
+			return 0, err
+		}
+
+		return w.updateType(h, t.Elem())
+
+	case reflect.Chan:
+		if h, err = w.update(h, t.ChanDir().String()); err != nil {
+			return 0, err
+		}
+
+		return w.updateType(h, t.Elem())
+
+	case reflect.Func:
+		for i := 0; i < t.NumIn(); i++ {
+			if h, err = w.updateType(h, t.In(i)); err != nil {
+				return 0, err
+			}
+		}
+
+		// Separate the inputs from the outputs
+		if h, err = w.update(h, "->"); err != nil {
+			return 0, err
+		}
+
+		for i := 0; i < t.NumOut(); i++ {
+			if h, err = w.updateType(h, t.Out(i)); err != nil {
+				return 0, err
+			}
+		}
+
+		return h, nil
+
+	case reflect.Interface:
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if h, err = w.update(h, m.Name); err != nil {
+				return 0, err
+			}
+			if h, err = w.updateType(h, m.Type); err != nil {
+				return 0, err
+			}
+		}
+
+		return h, nil
+
+	case reflect.Map:
+		if h, err = w.updateType(h, t.Key()); err != nil {
+			return 0, err
+		}
+
+		return w.updateType(h, t.Elem())
+
+	case reflect.Ptr, reflect.Slice:
+		return w.updateType(h, t.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// Unexported
+				continue
+			}
+
+			tag := f.Tag.Get(w.tag)
+			if tag == "ignore" || tag == "-" {
+				// Ignore this field
+				continue
+			}
+
+			name := f.Name
+			if w.nameTag != "" {
+				name = taggedName(f, w.nameTag)
+			}
+			if h, err = w.update(h, name); err != nil {
+				return 0, err
+			}
+			if h, err = w.update(h, string(f.Tag)); err != nil {
+				return 0, err
+			}
+			if h, err = w.updateType(h, f.Type); err != nil {
+				return 0, err
+			}
+		}
+
+		return h, nil
+
+	default:
+		return h, nil
+	}
+}
+
+// update returns h updated with the hash of s.
+func (w *schemaWalker) update(h uint64, s string) (uint64, error) {
+	sh, err := w.hashString(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, h, sh), nil
+}
+
+// updateType returns h updated with the hash of t.
+func (w *schemaWalker) updateType(h uint64, t reflect.Type) (uint64, error) {
+	th, err := w.visit(t)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, h, th), nil
+}
+
+func (w *schemaWalker) hashString(s string) (uint64, error) {
+	w.h.Reset()
+	_, err := w.h.Write([]byte(s))
+	return w.h.Sum64(), err
+}
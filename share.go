@@ -0,0 +1,49 @@
+package hashstructure
+
+import (
+	"reflect"
+)
+
+// countPointers walks v as w would and returns how many times each non-nil
+// pointer is reached. This is used by SharePointers to find pointers that
+// are referenced from more than one place. Walking v the same way means
+// that pointers in fields and values that w skips, such as redacted or
+// pruned ones, aren't counted.
+//
+// Pointers are counted by type as well as address, since a struct and its
+// first field share an address. Pointers to zero-size values aren't
+// counted at all, since distinct ones may share an address too.
+func (w *walker) countPointers(v reflect.Value) (map[cycleKey]int, error) {
+	c := *w
+	c.onIgnore = nil
+	c.logger = nil
+	c.counter = nil
+	c.parallel = false
+	c.pointers = nil
+	c.counts = make(map[cycleKey]int)
+	c.visiting = make(cycleSet)
+	c.getterTypes = nil
+	if _, err := c.visit(v, nil); err != nil {
+		return nil, err
+	}
+
+	// Nothing written while counting counts towards MaxBytes
+	if w.counter != nil {
+		w.counter.n = 0
+	}
+
+	return c.counts, nil
+}
+
+// countPointer records a reference to the pointer v while counting. It
+// returns false if v was already reached, in which case it isn't walked
+// again, so self-referential values don't cause this to loop forever.
+func (w *walker) countPointer(v reflect.Value) bool {
+	if v.IsNil() || v.Type().Elem().Size() == 0 {
+		return true
+	}
+
+	k := newCycleKey(v)
+	w.counts[k]++
+	return w.counts[k] == 1
+}
@@ -0,0 +1,42 @@
+package hashstructure
+
+import (
+	"reflect"
+)
+
+// visitTypeName hashes v, the value of an interface, together with the
+// name of its dynamic type. Pointers are transparent to the hash, so they
+// are named by the type they point to.
+func (w *walker) visitTypeName(v reflect.Value, opts *visitOpts) (uint64, error) {
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	name, ok := w.typeNames[t]
+	if !ok {
+		name = qualifiedName(t)
+	}
+
+	nh, err := w.visit(reflect.ValueOf(name), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	h, err := w.visit(v, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return hashUpdateOrdered(w.h, w.order, nh, h), nil
+}
+
+// qualifiedName returns the name of t qualified by its package path, or
+// its string form if it isn't a defined type.
+func qualifiedName(t reflect.Type) string {
+	if t.Name() == "" {
+		return t.String()
+	}
+
+	return t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,14 @@
+package hashstructure
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// exportedField returns field i of the addressable struct v as a value that
+// can be used like an exported field, including with Interface. This is how
+// IncludeUnexported reads unexported fields.
+func exportedField(v reflect.Value, i int) reflect.Value {
+	f := v.Field(i)
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+}